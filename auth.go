@@ -2,9 +2,13 @@ package gomail
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 // loginAuth is an smtp.Auth that implements the LOGIN authentication mechanism.
@@ -47,3 +51,133 @@ func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
 		return nil, fmt.Errorf("gomail: unexpected server challenge: %s", fromServer)
 	}
 }
+
+// oauthAuth is an smtp.Auth that implements the XOAUTH2 and OAUTHBEARER
+// authentication mechanisms.
+type oauthAuth struct {
+	mechanism string
+	username  string
+	token     string
+	host      string
+	port      int
+
+	mu  sync.Mutex
+	err *OAuthError
+}
+
+// XOAuth2Auth returns an smtp.Auth that implements the XOAUTH2 authentication
+// mechanism used by Gmail and Microsoft 365. token is an OAuth 2.0 access token
+// of the user.
+//
+// XOAuth2Auth will only send the token if the connection is using TLS or is
+// connected to localhost.
+func XOAuth2Auth(username, token, host string) smtp.Auth {
+	return &oauthAuth{
+		mechanism: "XOAUTH2",
+		username:  username,
+		token:     token,
+		host:      host,
+	}
+}
+
+// OAuthBearerAuth returns an smtp.Auth that implements the OAUTHBEARER
+// authentication mechanism as defined in RFC 7628. token is an OAuth 2.0 access
+// token of the user.
+//
+// OAuthBearerAuth will only send the token if the connection is using TLS or is
+// connected to localhost.
+func OAuthBearerAuth(username, token, host string, port int) smtp.Auth {
+	return &oauthAuth{
+		mechanism: "OAUTHBEARER",
+		username:  username,
+		token:     token,
+		host:      host,
+		port:      port,
+	}
+}
+
+func (a *oauthAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("gomail: unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("gomail: wrong host name")
+	}
+
+	a.mu.Lock()
+	a.err = nil
+	a.mu.Unlock()
+
+	var resp string
+	if a.mechanism == "XOAUTH2" {
+		resp = "user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"
+	} else {
+		resp = "n,a=" + escapeSASLName(a.username) + "," +
+			"\x01host=" + a.host +
+			"\x01port=" + strconv.Itoa(a.port) +
+			"\x01auth=Bearer " + a.token + "\x01\x01"
+	}
+	return a.mechanism, []byte(resp), nil
+}
+
+func (a *oauthAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	// The server sent an error challenge. It is recorded and the client must
+	// send a dummy response so that the server can fail the authentication.
+	oerr := &OAuthError{}
+	if err := json.Unmarshal(fromServer, oerr); err != nil {
+		return nil, fmt.Errorf("gomail: unexpected server challenge: %s", fromServer)
+	}
+	a.mu.Lock()
+	a.err = oerr
+	a.mu.Unlock()
+
+	if a.mechanism == "XOAUTH2" {
+		return []byte{}, nil
+	}
+	return []byte{0x01}, nil
+}
+
+// challengeError returns the error sent by the server during the last
+// authentication, if any.
+func (a *oauthAuth) challengeError() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err == nil {
+		return nil
+	}
+	return a.err
+}
+
+// An OAuthError is the error sent by the SMTP server when an OAuth 2.0
+// authentication fails, as defined in RFC 7628, section 3.2.2.
+type OAuthError struct {
+	// Status is the HTTP-like status of the error, e.g. "401" or
+	// "invalid_token".
+	Status string `json:"status"`
+	// Schemes is the space-separated list of supported authentication schemes.
+	Schemes string `json:"schemes"`
+	// Scope is the OAuth 2.0 scope needed to access the SMTP server.
+	Scope string `json:"scope"`
+}
+
+func (e *OAuthError) Error() string {
+	s := "gomail: OAuth 2.0 authentication failed with status " + e.Status
+	if e.Scope != "" {
+		s += " (required scope: " + e.Scope + ")"
+	}
+	return s
+}
+
+// escapeSASLName escapes a username as defined in RFC 5801, section 4.
+func escapeSASLName(name string) string {
+	name = strings.Replace(name, "=", "=3D", -1)
+	return strings.Replace(name, ",", "=2C", -1)
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
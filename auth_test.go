@@ -2,6 +2,7 @@ package gomail
 
 import (
 	"net/smtp"
+	"strings"
 	"testing"
 )
 
@@ -98,3 +99,63 @@ func testLoginAuth(t *testing.T, test *authTest) {
 		}
 	}
 }
+
+func TestXOAuth2(t *testing.T) {
+	auth := XOAuth2Auth(testUser, "token", testHost)
+	proto, toServer, err := auth.Start(&smtp.ServerInfo{Name: testHost, TLS: true})
+	if err != nil {
+		t.Fatalf("Start(): %v", err)
+	}
+	if proto != "XOAUTH2" {
+		t.Errorf("invalid protocol, got %q, want XOAUTH2", proto)
+	}
+	want := "user=" + testUser + "\x01auth=Bearer token\x01\x01"
+	if string(toServer) != want {
+		t.Errorf("Invalid response, got %q, want %q", toServer, want)
+	}
+}
+
+func TestOAuthBearer(t *testing.T) {
+	auth := OAuthBearerAuth("user,name", "token", testHost, testPort)
+	proto, toServer, err := auth.Start(&smtp.ServerInfo{Name: testHost, TLS: true})
+	if err != nil {
+		t.Fatalf("Start(): %v", err)
+	}
+	if proto != "OAUTHBEARER" {
+		t.Errorf("invalid protocol, got %q, want OAUTHBEARER", proto)
+	}
+	want := "n,a=user=2Cname,\x01host=" + testHost + "\x01port=587\x01auth=Bearer token\x01\x01"
+	if string(toServer) != want {
+		t.Errorf("Invalid response, got %q, want %q", toServer, want)
+	}
+}
+
+func TestOAuthUnencrypted(t *testing.T) {
+	auth := XOAuth2Auth(testUser, "token", testHost)
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: testHost, Auth: []string{"XOAUTH2"}}); err == nil {
+		t.Error("Start() should fail on an unencrypted connection")
+	}
+}
+
+func TestOAuthErrorChallenge(t *testing.T) {
+	for mechanism, want := range map[string]string{"XOAUTH2": "", "OAUTHBEARER": "\x01"} {
+		auth := &oauthAuth{mechanism: mechanism, username: testUser, token: "token", host: testHost}
+		if _, _, err := auth.Start(&smtp.ServerInfo{Name: testHost, TLS: true}); err != nil {
+			t.Fatalf("Start(): %v", err)
+		}
+
+		challenge := `{"status":"401","schemes":"bearer","scope":"https://mail.google.com/"}`
+		toServer, err := auth.Next([]byte(challenge), true)
+		if err != nil {
+			t.Fatalf("Next(): %v", err)
+		}
+		if string(toServer) != want {
+			t.Errorf("Invalid %s response, got %q, want %q", mechanism, toServer, want)
+		}
+
+		err = auth.challengeError()
+		if err == nil || !strings.Contains(err.Error(), "401") {
+			t.Errorf("Invalid %s challenge error, got %v", mechanism, err)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package gomail
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CalendarMethod is the iTIP method of a calendar invitation as defined in
+// RFC 5546.
+type CalendarMethod string
+
+const (
+	// MethodRequest invites attendees to an event or updates it.
+	MethodRequest CalendarMethod = "REQUEST"
+	// MethodCancel cancels an event.
+	MethodCancel CalendarMethod = "CANCEL"
+	// MethodReply answers an invitation. The Status of the attendee must be
+	// set.
+	MethodReply CalendarMethod = "REPLY"
+)
+
+// A CalendarEvent is an event sent in a calendar invitation with
+// Message.AddCalendarInvite.
+type CalendarEvent struct {
+	// Method is the method of the invitation. By default, MethodRequest is
+	// used.
+	Method CalendarMethod
+	// UID is the unique identifier of the event. It must stay the same when
+	// the event is updated or cancelled. If empty, AddCalendarInvite
+	// generates one and sets it.
+	UID string
+	// Sequence is the revision number of the event. It must be incremented
+	// each time the event is updated or cancelled.
+	Sequence int
+
+	Organizer CalendarAttendee
+	Attendees []CalendarAttendee
+
+	Start time.Time
+	End   time.Time
+	// TimeZone is the time zone in which the event is displayed. If nil, UTC
+	// times are used. time.Local is not supported since calendar clients
+	// cannot resolve its name: UTC times are also used.
+	TimeZone *time.Location
+
+	Summary     string
+	Description string
+	Location    string
+}
+
+// A CalendarAttendee is the organizer or an attendee of a CalendarEvent.
+type CalendarAttendee struct {
+	Name    string
+	Address string
+	// Optional defines whether the participation of the attendee is optional.
+	Optional bool
+	// Status is the participation status of the attendee, e.g. "ACCEPTED",
+	// "DECLINED" or "TENTATIVE". By default, it is "NEEDS-ACTION".
+	Status string
+	// RSVP defines whether a reply is expected from the attendee.
+	RSVP bool
+}
+
+// AddCalendarInvite adds a calendar invitation to the message, as defined in
+// RFC 6047. The event is added as a text/calendar alternative part, which is
+// rendered as an invitation by most email clients, and as an invite.ics
+// attachment for the others.
+//
+// A text/plain or text/html body describing the event should be set before.
+func (m *Message) AddCalendarInvite(e *CalendarEvent) {
+	method := e.Method
+	if method == "" {
+		method = MethodRequest
+	}
+	if e.UID == "" {
+		domain := "localhost"
+		if i := strings.LastIndexByte(e.Organizer.Address, '@'); i != -1 {
+			domain = e.Organizer.Address[i+1:]
+		}
+		e.UID = newMessageIDToken() + "@" + domain
+	}
+	ics := e.ics(method)
+
+	m.AddAlternative("text/calendar; method="+string(method), ics)
+	m.Attach("invite.ics",
+		SetHeader(map[string][]string{
+			"Content-Type": {`application/ics; name="invite.ics"`},
+		}),
+		SetCopyFunc(func(w io.Writer) error {
+			_, err := io.WriteString(w, ics)
+			return err
+		}),
+	)
+}
+
+// ics returns the iCalendar object of the event as defined in RFC 5545.
+func (e *CalendarEvent) ics(method CalendarMethod) string {
+	w := &icsWriter{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("PRODID:-//gomail//gomail//EN")
+	w.line("VERSION:2.0")
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:" + string(method))
+
+	loc := e.TimeZone
+	if loc != nil && loc != time.UTC && loc != time.Local {
+		w.timezone(loc, e.Start, e.End)
+	} else {
+		loc = nil
+	}
+
+	w.line("BEGIN:VEVENT")
+	w.line("UID:" + icsText(e.UID))
+	w.line("SEQUENCE:" + strconv.Itoa(e.Sequence))
+	w.line("DTSTAMP:" + icsTime(now(), nil))
+	w.line("DTSTART" + icsTimeParam(loc) + ":" + icsTime(e.Start, loc))
+	w.line("DTEND" + icsTimeParam(loc) + ":" + icsTime(e.End, loc))
+	if e.Summary != "" {
+		w.line("SUMMARY:" + icsText(e.Summary))
+	}
+	if e.Description != "" {
+		w.line("DESCRIPTION:" + icsText(e.Description))
+	}
+	if e.Location != "" {
+		w.line("LOCATION:" + icsText(e.Location))
+	}
+	if e.Organizer.Address != "" {
+		w.line("ORGANIZER" + icsName(e.Organizer.Name) + ":mailto:" + e.Organizer.Address)
+	}
+	for _, a := range e.Attendees {
+		role, status := "REQ-PARTICIPANT", a.Status
+		if a.Optional {
+			role = "OPT-PARTICIPANT"
+		}
+		if status == "" {
+			status = "NEEDS-ACTION"
+		}
+		params := icsName(a.Name) + ";ROLE=" + role + ";PARTSTAT=" + status
+		if a.RSVP {
+			params += ";RSVP=TRUE"
+		}
+		w.line("ATTENDEE" + params + ":mailto:" + a.Address)
+	}
+	if method == MethodCancel {
+		w.line("STATUS:CANCELLED")
+	} else {
+		w.line("STATUS:CONFIRMED")
+	}
+	w.line("END:VEVENT")
+	w.line("END:VCALENDAR")
+
+	return w.String()
+}
+
+// icsWriter writes the content lines of an iCalendar object.
+type icsWriter struct {
+	strings.Builder
+}
+
+// line writes a content line, folded after 75 octets as required by RFC 5545,
+// section 3.1.
+func (w *icsWriter) line(s string) {
+	limit := 75
+	for len(s) > limit {
+		// Do not split UTF-8 characters.
+		i := limit
+		for i > 0 && s[i]&0xc0 == 0x80 {
+			i--
+		}
+		w.WriteString(s[:i])
+		w.WriteString("\r\n ")
+		s = s[i:]
+		limit = 74
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+// timezone writes a VTIMEZONE component describing loc during the event. Only
+// the offsets used between start and end are described, which is enough for a
+// single event.
+func (w *icsWriter) timezone(loc *time.Location, start, end time.Time) {
+	start, end = start.In(loc), end.In(loc)
+	w.line("BEGIN:VTIMEZONE")
+	w.line("TZID:" + loc.String())
+
+	name, offset := start.Zone()
+	w.zone(offset, offset, name, start.IsDST(), time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	// Look for a transition during the event.
+	if _, endOffset := end.Zone(); endOffset != offset {
+		lo, hi := start.Unix(), end.Unix()
+		for hi-lo > 1 {
+			mid := lo + (hi-lo)/2
+			if _, o := time.Unix(mid, 0).In(loc).Zone(); o == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		transition := time.Unix(hi, 0).In(loc)
+		endName, _ := transition.Zone()
+		// The start of the transition is expressed in the local time before
+		// it.
+		t := time.Unix(hi, 0).UTC().Add(time.Duration(offset) * time.Second)
+		w.zone(offset, endOffset, endName, transition.IsDST(), t)
+	}
+	w.line("END:VTIMEZONE")
+}
+
+// zone writes a DAYLIGHT component if dst is true, and a STANDARD component
+// otherwise.
+func (w *icsWriter) zone(from, to int, name string, dst bool, start time.Time) {
+	component := "STANDARD"
+	if dst {
+		component = "DAYLIGHT"
+	}
+	w.line("BEGIN:" + component)
+	w.line("DTSTART:" + start.Format("20060102T150405"))
+	w.line("TZOFFSETFROM:" + icsOffset(from))
+	w.line("TZOFFSETTO:" + icsOffset(to))
+	w.line("TZNAME:" + icsText(name))
+	w.line("END:" + component)
+}
+
+func icsOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	h, m := offset/3600, offset%3600/60
+	return sign + twoDigits(h) + twoDigits(m)
+}
+
+func twoDigits(n int) string {
+	if n < 10 {
+		return "0" + strconv.Itoa(n)
+	}
+	return strconv.Itoa(n)
+}
+
+func icsTimeParam(loc *time.Location) string {
+	if loc == nil {
+		return ""
+	}
+	return ";TZID=" + loc.String()
+}
+
+// icsTime formats t in UTC if loc is nil, or as a local time of loc.
+func icsTime(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		return t.UTC().Format("20060102T150405Z")
+	}
+	return t.In(loc).Format("20060102T150405")
+}
+
+// icsName returns the CN parameter of a name.
+func icsName(name string) string {
+	if name == "" {
+		return ""
+	}
+	name = strings.Replace(name, `"`, "'", -1)
+	if strings.ContainsAny(name, ",;:") {
+		name = `"` + name + `"`
+	}
+	return ";CN=" + name
+}
+
+var icsTextReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+// icsText escapes a TEXT value as defined in RFC 5545, section 3.3.11.
+func icsText(s string) string {
+	return icsTextReplacer.Replace(s)
+}
@@ -0,0 +1,200 @@
+package gomail
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func getTestEvent() *CalendarEvent {
+	return &CalendarEvent{
+		UID:       "event-1@example.com",
+		Sequence:  1,
+		Organizer: CalendarAttendee{Name: "Alice", Address: "alice@example.com"},
+		Attendees: []CalendarAttendee{
+			{Name: "Bob, Jr.", Address: "bob@example.com", RSVP: true},
+			{Address: "carol@example.com", Optional: true},
+		},
+		Start:       time.Date(2014, 7, 1, 9, 0, 0, 0, time.UTC),
+		End:         time.Date(2014, 7, 1, 10, 0, 0, 0, time.UTC),
+		Summary:     "Weekly meeting",
+		Description: "Agenda:\n1. Budget; 2. Planning",
+		Location:    "Room 42",
+	}
+}
+
+func TestCalendarEvent(t *testing.T) {
+	got := getTestEvent().ics(MethodRequest)
+	want := "BEGIN:VCALENDAR\r\n" +
+		"PRODID:-//gomail//gomail//EN\r\n" +
+		"VERSION:2.0\r\n" +
+		"CALSCALE:GREGORIAN\r\n" +
+		"METHOD:REQUEST\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:event-1@example.com\r\n" +
+		"SEQUENCE:1\r\n" +
+		"DTSTAMP:20140625T174600Z\r\n" +
+		"DTSTART:20140701T090000Z\r\n" +
+		"DTEND:20140701T100000Z\r\n" +
+		"SUMMARY:Weekly meeting\r\n" +
+		"DESCRIPTION:Agenda:\\n1. Budget\\; 2. Planning\r\n" +
+		"LOCATION:Room 42\r\n" +
+		"ORGANIZER;CN=Alice:mailto:alice@example.com\r\n" +
+		"ATTENDEE;CN=\"Bob, Jr.\";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE\r\n" +
+		" :mailto:bob@example.com\r\n" +
+		"ATTENDEE;ROLE=OPT-PARTICIPANT;PARTSTAT=NEEDS-ACTION:mailto:carol@example.co\r\n" +
+		" m\r\n" +
+		"STATUS:CONFIRMED\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	if got != want {
+		t.Errorf("Invalid iCalendar object, got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCalendarCancel(t *testing.T) {
+	e := getTestEvent()
+	e.Method = MethodCancel
+	m := NewMessage()
+	m.AddCalendarInvite(e)
+
+	if got, want := m.parts[0].contentType, "text/calendar; method=CANCEL"; got != want {
+		t.Errorf("Invalid content type, got %q, want %q", got, want)
+	}
+	content, err := m.parts[0].content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(content, "METHOD:CANCEL\r\n") || !strings.Contains(content, "STATUS:CANCELLED\r\n") {
+		t.Errorf("Invalid iCalendar object:\n%s", content)
+	}
+}
+
+func TestCalendarGeneratedUID(t *testing.T) {
+	e := getTestEvent()
+	e.UID = ""
+	m := NewMessage()
+	m.AddCalendarInvite(e)
+
+	// The UID must be known to update or cancel the event.
+	if want := "test@example.com"; e.UID != want {
+		t.Errorf("Invalid UID, got %q, want %q", e.UID, want)
+	}
+	content, err := m.parts[0].content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(content, "UID:"+e.UID+"\r\n") {
+		t.Errorf("Missing UID %q in:\n%s", e.UID, content)
+	}
+}
+
+func TestCalendarTimeZone(t *testing.T) {
+	e := getTestEvent()
+	e.TimeZone = time.FixedZone("EST", -5*3600)
+	got := e.ics(MethodRequest)
+
+	for _, want := range []string{
+		"BEGIN:VTIMEZONE\r\n" +
+			"TZID:EST\r\n" +
+			"BEGIN:STANDARD\r\n" +
+			"DTSTART:19700101T000000\r\n" +
+			"TZOFFSETFROM:-0500\r\n" +
+			"TZOFFSETTO:-0500\r\n" +
+			"TZNAME:EST\r\n" +
+			"END:STANDARD\r\n" +
+			"END:VTIMEZONE\r\n",
+		"DTSTART;TZID=EST:20140701T040000\r\n",
+		"DTEND;TZID=EST:20140701T050000\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestCalendarLocalTimeZone(t *testing.T) {
+	e := getTestEvent()
+	e.TimeZone = time.Local
+	got := e.ics(MethodRequest)
+
+	if strings.Contains(got, "TZID") || !strings.Contains(got, "DTSTART:20140701T090000Z\r\n") {
+		t.Errorf("Invalid iCalendar object with time.Local:\n%s", got)
+	}
+}
+
+func TestCalendarTimeZoneTransition(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("Time zone database not available")
+	}
+	e := getTestEvent()
+	e.TimeZone = loc
+	e.Start = time.Date(2014, 3, 30, 1, 0, 0, 0, loc)
+	e.End = time.Date(2014, 3, 30, 4, 0, 0, 0, loc)
+	got := e.ics(MethodRequest)
+
+	want := "BEGIN:DAYLIGHT\r\n" +
+		"DTSTART:20140330T020000\r\n" +
+		"TZOFFSETFROM:+0100\r\n" +
+		"TZOFFSETTO:+0200\r\n" +
+		"TZNAME:CEST\r\n" +
+		"END:DAYLIGHT\r\n"
+	if !strings.Contains(got, want) {
+		t.Errorf("Missing %q in:\n%s", want, got)
+	}
+}
+
+func TestCalendarTimeZoneSouthern(t *testing.T) {
+	loc, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Skip("Time zone database not available")
+	}
+	e := getTestEvent()
+	e.TimeZone = loc
+	e.Start = time.Date(2014, 4, 6, 1, 0, 0, 0, loc)
+	e.End = time.Date(2014, 4, 6, 4, 0, 0, 0, loc)
+	got := e.ics(MethodRequest)
+
+	want := "BEGIN:DAYLIGHT\r\n" +
+		"DTSTART:19700101T000000\r\n" +
+		"TZOFFSETFROM:+1100\r\n" +
+		"TZOFFSETTO:+1100\r\n" +
+		"TZNAME:AEDT\r\n" +
+		"END:DAYLIGHT\r\n" +
+		"BEGIN:STANDARD\r\n" +
+		"DTSTART:20140406T030000\r\n" +
+		"TZOFFSETFROM:+1100\r\n" +
+		"TZOFFSETTO:+1000\r\n" +
+		"TZNAME:AEST\r\n" +
+		"END:STANDARD\r\n"
+	if !strings.Contains(got, want) {
+		t.Errorf("Missing %q in:\n%s", want, got)
+	}
+}
+
+func TestAddCalendarInvite(t *testing.T) {
+	m := NewMessage()
+	m.SetHeader("From", "alice@example.com")
+	m.SetHeader("To", "bob@example.com")
+	m.SetBody("text/plain", "Weekly meeting")
+	m.AddCalendarInvite(getTestEvent())
+
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"Content-Type: multipart/mixed;",
+		"Content-Type: multipart/alternative;",
+		"Content-Type: text/calendar; method=REQUEST; charset=UTF-8\r\n",
+		"Content-Type: application/ics; name=\"invite.ics\"\r\n",
+		"Content-Disposition: attachment; filename=\"invite.ics\"\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Missing %q in:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package gomail
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// client is an smtpClient implementing the SMTP protocol as defined in RFC
+// 5321. Unlike smtp.Client, it sends the MAIL and RCPT commands with the given
+// parameters only, it supports the BDAT command and it can pipeline the
+// commands of a mail transaction.
+type client struct {
+	text       *textproto.Conn
+	conn       net.Conn
+	serverName string
+	localName  string
+	tls        bool
+	didHello   bool
+	helloError error
+	ext        map[string]string
+	auth       []string
+}
+
+// newClient returns a client using conn once the SMTP server sent its
+// greeting. host is the name of the SMTP server used when authenticating.
+func newClient(conn net.Conn, host string) (*client, error) {
+	text := textproto.NewConn(conn)
+	if _, _, err := text.ReadResponse(220); err != nil {
+		text.Close()
+		return nil, err
+	}
+	_, isTLS := conn.(*tls.Conn)
+	return &client{
+		text:       text,
+		conn:       conn,
+		serverName: host,
+		localName:  "localhost",
+		tls:        isTLS,
+	}, nil
+}
+
+// Hello sends the EHLO command, or the HELO command if the SMTP server does
+// not support EHLO. It must be called before any other command.
+func (c *client) Hello(localName string) error {
+	if err := validateLine(localName); err != nil {
+		return err
+	}
+	if c.didHello {
+		return errors.New("gomail: Hello called after other methods")
+	}
+	c.localName = localName
+	return c.hello()
+}
+
+func (c *client) hello() error {
+	if !c.didHello {
+		c.didHello = true
+		if c.helloError = c.ehlo(); c.helloError != nil {
+			c.helloError = c.helo()
+		}
+	}
+	return c.helloError
+}
+
+func (c *client) ehlo() error {
+	_, msg, err := c.cmd(250, "EHLO "+c.localName)
+	if err != nil {
+		return err
+	}
+	// The first line of the reply is the greeting, each following line is an
+	// extension keyword followed by its parameters.
+	c.ext = make(map[string]string)
+	for _, line := range strings.Split(msg, "\n")[1:] {
+		kv := strings.SplitN(line, " ", 2)
+		if len(kv) == 2 {
+			c.ext[strings.ToUpper(kv[0])] = kv[1]
+		} else {
+			c.ext[strings.ToUpper(kv[0])] = ""
+		}
+	}
+	if mechanisms, ok := c.ext["AUTH"]; ok {
+		c.auth = strings.Fields(mechanisms)
+	}
+	return nil
+}
+
+func (c *client) helo() error {
+	c.ext = nil
+	_, _, err := c.cmd(250, "HELO "+c.localName)
+	return err
+}
+
+func (c *client) Extension(ext string) (bool, string) {
+	if err := c.hello(); err != nil || c.ext == nil {
+		return false, ""
+	}
+	param, ok := c.ext[strings.ToUpper(ext)]
+	return ok, param
+}
+
+// StartTLS sends the STARTTLS command and encrypts all further communication.
+// The extensions are then advertised again by the SMTP server.
+func (c *client) StartTLS(config *tls.Config) error {
+	if err := c.hello(); err != nil {
+		return err
+	}
+	if _, _, err := c.cmd(220, "STARTTLS"); err != nil {
+		return err
+	}
+	c.conn = tlsClient(c.conn, config)
+	c.text = textproto.NewConn(c.conn)
+	c.tls = true
+	return c.ehlo()
+}
+
+func (c *client) TLSConnectionState() (tls.ConnectionState, bool) {
+	tc, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	return tc.ConnectionState(), true
+}
+
+// Auth authenticates with the given mechanism. If it fails, the connection
+// must not be used anymore.
+func (c *client) Auth(a smtp.Auth) error {
+	if err := c.hello(); err != nil {
+		return err
+	}
+	encoding := base64.StdEncoding
+	mechanism, resp, err := a.Start(&smtp.ServerInfo{
+		Name: c.serverName,
+		TLS:  c.tls,
+		Auth: c.auth,
+	})
+	if err != nil {
+		c.Quit()
+		return err
+	}
+
+	line := "AUTH " + mechanism
+	if len(resp) > 0 {
+		line += " " + encoding.EncodeToString(resp)
+	}
+	code, msg, err := c.cmd(0, line)
+	for err == nil {
+		var challenge []byte
+		switch code {
+		case 334:
+			challenge, err = encoding.DecodeString(msg)
+		case 235:
+			// The last reply is not a challenge so it is not encoded.
+			challenge = []byte(msg)
+		default:
+			err = &textproto.Error{Code: code, Msg: msg}
+		}
+		if err == nil {
+			resp, err = a.Next(challenge, code == 334)
+		}
+		if err != nil {
+			// Cancel the authentication exchange.
+			c.cmd(501, "*")
+			c.Quit()
+			break
+		}
+		if resp == nil {
+			break
+		}
+		code, msg, err = c.cmd(0, encoding.EncodeToString(resp))
+	}
+	return err
+}
+
+func (c *client) Mail(from string, params ...string) error {
+	if err := c.hello(); err != nil {
+		return err
+	}
+	_, _, err := c.cmd(250, mailCommand(from, params))
+	return err
+}
+
+func (c *client) Rcpt(to string, params ...string) error {
+	_, _, err := c.cmd(25, rcptCommand(to, params))
+	return err
+}
+
+func (c *client) Data() (io.WriteCloser, error) {
+	if _, _, err := c.cmd(354, "DATA"); err != nil {
+		return nil, err
+	}
+	return &dataWriter{c: c, WriteCloser: c.text.DotWriter()}, nil
+}
+
+// dataWriter writes the content of an email after the DATA command.
+type dataWriter struct {
+	c *client
+	io.WriteCloser
+}
+
+// Close ends the content of the email and waits for the SMTP server to accept
+// it.
+func (w *dataWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	_, _, err := w.c.text.ReadResponse(250)
+	return err
+}
+
+func (c *client) Bdat(chunk []byte, last bool) error {
+	line := "BDAT " + strconv.Itoa(len(chunk))
+	if last {
+		line += " LAST"
+	}
+	if _, err := c.text.W.WriteString(line + "\r\n"); err != nil {
+		return err
+	}
+	if _, err := c.text.W.Write(chunk); err != nil {
+		return err
+	}
+	if err := c.text.W.Flush(); err != nil {
+		return err
+	}
+	_, _, err := c.text.ReadResponse(250)
+	return err
+}
+
+// Pipeline sends the MAIL and RCPT commands of e, followed by the DATA command
+// if data is true, in a single flight as defined in RFC 2920. It then reads
+// the reply to each command.
+//
+// The returned error is only set if the replies could not be read. The error
+// replies of the SMTP server are reported in the returned pipelineReplies.
+func (c *client) Pipeline(e *envelope, data bool) (*pipelineReplies, error) {
+	if err := c.hello(); err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, len(e.to)+2)
+	codes := make([]int, 0, len(e.to)+2)
+	lines = append(lines, mailCommand(e.from, e.params))
+	codes = append(codes, 250)
+	for i, to := range e.to {
+		lines = append(lines, rcptCommand(to, e.rcptParams[i]))
+		codes = append(codes, 25)
+	}
+	if data {
+		lines = append(lines, "DATA")
+		codes = append(codes, 354)
+	}
+	for _, line := range lines {
+		if err := validateLine(line); err != nil {
+			return nil, err
+		}
+	}
+	for _, line := range lines {
+		if _, err := c.text.W.WriteString(line + "\r\n"); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.text.W.Flush(); err != nil {
+		return nil, err
+	}
+
+	replies := make([]error, len(lines))
+	for i, code := range codes {
+		_, _, err := c.text.ReadResponse(code)
+		if _, ok := err.(*textproto.Error); err != nil && !ok {
+			return nil, err
+		}
+		replies[i] = err
+	}
+
+	r := &pipelineReplies{mail: replies[0], rcpt: replies[1 : len(e.to)+1]}
+	if data {
+		r.data = replies[len(replies)-1]
+		if r.data == nil {
+			r.w = &dataWriter{c: c, WriteCloser: c.text.DotWriter()}
+		}
+	}
+	return r, nil
+}
+
+func (c *client) Noop() error {
+	_, _, err := c.cmd(250, "NOOP")
+	return err
+}
+
+func (c *client) Reset() error {
+	_, _, err := c.cmd(250, "RSET")
+	return err
+}
+
+func (c *client) Quit() error {
+	if _, _, err := c.cmd(221, "QUIT"); err != nil {
+		return err
+	}
+	return c.text.Close()
+}
+
+func (c *client) Close() error {
+	return c.text.Close()
+}
+
+// cmd sends a command and waits for the reply of the SMTP server.
+func (c *client) cmd(expectCode int, line string) (int, string, error) {
+	if err := validateLine(line); err != nil {
+		return 0, "", err
+	}
+	if _, err := c.text.W.WriteString(line + "\r\n"); err != nil {
+		return 0, "", err
+	}
+	if err := c.text.W.Flush(); err != nil {
+		return 0, "", err
+	}
+	return c.text.ReadResponse(expectCode)
+}
+
+func mailCommand(from string, params []string) string {
+	return strings.Join(append([]string{"MAIL FROM:<" + from + ">"}, params...), " ")
+}
+
+func rcptCommand(to string, params []string) string {
+	return strings.Join(append([]string{"RCPT TO:<" + to + ">"}, params...), " ")
+}
+
+// validateLine checks that a command line cannot be used to inject other
+// commands.
+func validateLine(line string) error {
+	if strings.ContainsAny(line, "\r\n") {
+		return errors.New("gomail: a line must not contain CR or LF")
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package gomail
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A DKIMSigner signs emails with a DKIM-Signature header field as defined in
+// RFC 6376. RSA-SHA256 and Ed25519-SHA256 (RFC 8463) signatures are supported.
+//
+// The signature covers the exact bytes of the email so no other header field
+// must be added afterwards.
+type DKIMSigner struct {
+	// Domain is the signing domain, e.g. "example.com".
+	Domain string
+	// Selector is the selector of the public key in the DNS, e.g. "mail". The
+	// public key must be published in the TXT record of
+	// <Selector>._domainkey.<Domain>.
+	Selector string
+	// Signer is the private key used to sign emails. It must be an
+	// *rsa.PrivateKey or an ed25519.PrivateKey.
+	Signer crypto.Signer
+	// Headers is the list of header fields to sign. By default,
+	// DefaultDKIMHeaders is used. The From field is always signed.
+	Headers []string
+	// HeaderCanonicalization is the canonicalization algorithm of the header.
+	// By default, RelaxedCanonicalization is used.
+	HeaderCanonicalization Canonicalization
+	// BodyCanonicalization is the canonicalization algorithm of the body. By
+	// default, RelaxedCanonicalization is used.
+	BodyCanonicalization Canonicalization
+}
+
+// DefaultDKIMHeaders is the default list of header fields signed by a
+// DKIMSigner.
+var DefaultDKIMHeaders = []string{
+	"From", "Sender", "Reply-To", "Subject", "Date", "Message-ID", "To", "Cc",
+	"Mime-Version", "Content-Type", "Content-Transfer-Encoding", "Content-ID",
+	"Content-Description", "In-Reply-To", "References",
+}
+
+// Canonicalization represents a DKIM canonicalization algorithm.
+type Canonicalization string
+
+const (
+	// SimpleCanonicalization tolerates almost no modification of the email.
+	SimpleCanonicalization Canonicalization = "simple"
+	// RelaxedCanonicalization tolerates common modifications of whitespaces
+	// and header field line folding.
+	RelaxedCanonicalization Canonicalization = "relaxed"
+)
+
+// SetDKIM is a message setting to sign the email with the given DKIMSigner
+// when it is written.
+func SetDKIM(s *DKIMSigner) MessageSetting {
+	return func(m *Message) {
+		m.dkim = s
+	}
+}
+
+// NewDKIMSender returns a Sender that signs each email with the given
+// DKIMSigner before sending it with s.
+//
+// A Message is still given to s as a Message, so that it is signed once it is
+// encoded for the SMTP server, as with SetDKIM.
+func NewDKIMSender(s Sender, signer *DKIMSigner) Sender {
+	return &dkimSender{withContextSender(s), signer}
+}
+
+type dkimSender struct {
+	s      ContextSender
+	signer *DKIMSigner
+}
+
+func (s *dkimSender) Send(from string, to []string, msg io.WriterTo) error {
+	return s.SendContext(context.Background(), from, to, msg)
+}
+
+func (s *dkimSender) SendContext(ctx context.Context, from string, to []string, msg io.WriterTo) error {
+	if m, ok := msg.(*Message); ok {
+		signed := *m
+		signed.buf = bytes.Buffer{}
+		signed.dkim = s.signer
+		return s.s.SendContext(ctx, from, to, &signed)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := msg.WriteTo(buf); err != nil {
+		return err
+	}
+	signed := new(bytes.Buffer)
+	if _, err := s.signer.Sign(signed, buf.Bytes()); err != nil {
+		return err
+	}
+	return s.s.SendContext(ctx, from, to, signed)
+}
+
+// Sign writes msg to w, preceded by its DKIM-Signature header field. msg must
+// be a complete email using CRLF line endings.
+func (s *DKIMSigner) Sign(w io.Writer, msg []byte) (int64, error) {
+	field, err := s.signature(msg)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := io.WriteString(w, field)
+	if err != nil {
+		return int64(n), err
+	}
+	n2, err := w.Write(msg)
+	return int64(n + n2), err
+}
+
+// signature returns the DKIM-Signature header field of msg.
+func (s *DKIMSigner) signature(msg []byte) (string, error) {
+	var algorithm string
+	var hash crypto.Hash
+	switch s.Signer.Public().(type) {
+	case *rsa.PublicKey:
+		algorithm, hash = "rsa-sha256", crypto.SHA256
+	case ed25519.PublicKey:
+		// Ed25519 signs the SHA-256 hash of the data, see RFC 8463.
+		algorithm, hash = "ed25519-sha256", crypto.Hash(0)
+	default:
+		return "", errors.New("gomail: unsupported DKIM key type")
+	}
+
+	hc, bc := s.HeaderCanonicalization, s.BodyCanonicalization
+	if hc == "" {
+		hc = RelaxedCanonicalization
+	}
+	if bc == "" {
+		bc = RelaxedCanonicalization
+	}
+
+	header, body := splitMessage(msg)
+	bodyHash := sha256.Sum256(canonicalBody(body, bc))
+
+	fields := parseHeaderFields(header)
+	names := s.Headers
+	if names == nil {
+		names = DefaultDKIMHeaders
+	}
+	if !containsFold(names, "From") {
+		names = append([]string{"From"}, names...)
+	}
+
+	// When a header field appears several times, its instances are signed
+	// from the bottom up.
+	h := sha256.New()
+	var signed []string
+	used := make(map[int]bool)
+	for _, name := range names {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if used[i] || !strings.EqualFold(fields[i].name, name) {
+				continue
+			}
+			used[i] = true
+			io.WriteString(h, canonicalHeader(fields[i], hc))
+			signed = append(signed, fields[i].name)
+			break
+		}
+	}
+
+	field := "DKIM-Signature: v=1; a=" + algorithm +
+		"; c=" + string(hc) + "/" + string(bc) +
+		"; d=" + s.Domain +
+		"; s=" + s.Selector +
+		";\r\n t=" + strconv.FormatInt(now().Unix(), 10) +
+		"; h=" + foldDKIMList(signed) +
+		";\r\n bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) +
+		";\r\n b="
+
+	// The signature covers its own header field with an empty b= tag and
+	// without the trailing CRLF.
+	sigField := parseHeaderFields([]byte(field + "\r\n"))[0]
+	io.WriteString(h, strings.TrimSuffix(canonicalHeader(sigField, hc), "\r\n"))
+
+	digest := h.Sum(nil)
+	sig, err := s.Signer.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return "", err
+	}
+
+	return field + foldBase64(base64.StdEncoding.EncodeToString(sig)) + "\r\n", nil
+}
+
+// foldDKIMList joins header field names with colons, folding the line when it
+// becomes too long.
+func foldDKIMList(names []string) string {
+	var b strings.Builder
+	lineLen := len(" t=1234567890; h=")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(':')
+			lineLen++
+			if lineLen+len(name) > maxLineLen {
+				b.WriteString("\r\n ")
+				lineLen = 1
+			}
+		}
+		b.WriteString(name)
+		lineLen += len(name)
+	}
+	return b.String()
+}
+
+// foldBase64 folds a base64 string on several header lines.
+func foldBase64(s string) string {
+	var b strings.Builder
+	first := maxLineLen - len(" b=")
+	for len(s) > first {
+		b.WriteString(s[:first])
+		b.WriteString("\r\n ")
+		s = s[first:]
+		first = maxLineLen - 1
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+type headerField struct {
+	name string
+	// raw is the whole field including its name, line folding and trailing
+	// CRLF.
+	raw string
+}
+
+// splitMessage splits an email into its header and its body.
+func splitMessage(msg []byte) (header, body []byte) {
+	if i := bytes.Index(msg, []byte("\r\n\r\n")); i != -1 {
+		return msg[:i+2], msg[i+4:]
+	}
+	return msg, nil
+}
+
+// parseHeaderFields parses the fields of a header using CRLF line endings.
+func parseHeaderFields(header []byte) []headerField {
+	var fields []headerField
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].raw += line
+			continue
+		}
+		name := line
+		if i := strings.IndexByte(line, ':'); i != -1 {
+			name = line[:i]
+		}
+		fields = append(fields, headerField{name: strings.TrimSpace(name), raw: line})
+	}
+	return fields
+}
+
+// canonicalHeader returns a header field canonicalized as defined in RFC 6376,
+// section 3.4.1 and 3.4.2.
+func canonicalHeader(f headerField, c Canonicalization) string {
+	if c == SimpleCanonicalization {
+		return f.raw
+	}
+
+	value := f.raw
+	if i := strings.IndexByte(value, ':'); i != -1 {
+		value = value[i+1:]
+	}
+	value = strings.Replace(value, "\r\n", "", -1)
+	value = strings.TrimSpace(compressWSP(value))
+	return strings.ToLower(f.name) + ":" + value + "\r\n"
+}
+
+// canonicalBody returns a body canonicalized as defined in RFC 6376, section
+// 3.4.3 and 3.4.4.
+func canonicalBody(body []byte, c Canonicalization) []byte {
+	s := string(body)
+	if c == RelaxedCanonicalization {
+		lines := strings.Split(s, "\r\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(compressWSP(line), " ")
+		}
+		s = strings.Join(lines, "\r\n")
+	}
+
+	// Remove the empty lines at the end of the body.
+	for strings.HasSuffix(s, "\r\n") {
+		s = strings.TrimSuffix(s, "\r\n")
+	}
+	if s == "" {
+		if c == SimpleCanonicalization {
+			return []byte("\r\n")
+		}
+		return nil
+	}
+	return []byte(s + "\r\n")
+}
+
+// compressWSP replaces each sequence of spaces and tabs by a single space.
+func compressWSP(s string) string {
+	var b strings.Builder
+	wsp := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\t' {
+			wsp = true
+			continue
+		}
+		if wsp {
+			b.WriteByte(' ')
+			wsp = false
+		}
+		b.WriteByte(s[i])
+	}
+	if wsp {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
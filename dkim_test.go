@@ -0,0 +1,224 @@
+package gomail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDKIMCanonicalBody(t *testing.T) {
+	// Examples of RFC 6376, section 3.4.5.
+	body := []byte(" C \r\nD \t E\r\n\r\n\r\n")
+	if got, want := string(canonicalBody(body, SimpleCanonicalization)), " C \r\nD \t E\r\n"; got != want {
+		t.Errorf("Invalid simple body, got %q, want %q", got, want)
+	}
+	if got, want := string(canonicalBody(body, RelaxedCanonicalization)), " C\r\nD E\r\n"; got != want {
+		t.Errorf("Invalid relaxed body, got %q, want %q", got, want)
+	}
+
+	if got, want := string(canonicalBody(nil, SimpleCanonicalization)), "\r\n"; got != want {
+		t.Errorf("Invalid simple empty body, got %q, want %q", got, want)
+	}
+	if got := canonicalBody(nil, RelaxedCanonicalization); len(got) != 0 {
+		t.Errorf("Invalid relaxed empty body, got %q, want an empty body", got)
+	}
+}
+
+func TestDKIMCanonicalHeader(t *testing.T) {
+	// Examples of RFC 6376, section 3.4.5.
+	fields := parseHeaderFields([]byte("A: X\r\nB : Y\t\r\n\tZ  \r\n"))
+	want := []string{"a:X\r\n", "b:Y Z\r\n"}
+	if len(fields) != len(want) {
+		t.Fatalf("Invalid number of fields, got %d, want %d", len(fields), len(want))
+	}
+	for i, f := range fields {
+		if got := canonicalHeader(f, RelaxedCanonicalization); got != want[i] {
+			t.Errorf("Invalid relaxed header, got %q, want %q", got, want[i])
+		}
+		if got := canonicalHeader(f, SimpleCanonicalization); got != f.raw {
+			t.Errorf("Invalid simple header, got %q, want %q", got, f.raw)
+		}
+	}
+}
+
+func TestDKIMEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &DKIMSigner{Domain: "example.com", Selector: "mail", Signer: priv}
+
+	msg := writeDKIMMessage(t, s)
+	verifyDKIM(t, msg, func(digest, sig []byte) bool {
+		return ed25519.Verify(pub, digest, sig)
+	})
+}
+
+func TestDKIMRSASimple(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &DKIMSigner{
+		Domain:                 "example.com",
+		Selector:               "mail",
+		Signer:                 key,
+		HeaderCanonicalization: SimpleCanonicalization,
+		BodyCanonicalization:   SimpleCanonicalization,
+	}
+
+	msg := writeDKIMMessage(t, s)
+	verifyDKIM(t, msg, func(digest, sig []byte) bool {
+		return rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest, sig) == nil
+	})
+}
+
+func TestDKIMSender(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &DKIMSigner{Domain: "example.com", Selector: "mail", Signer: priv}
+
+	var got string
+	s := NewDKIMSender(SendFunc(func(from string, to []string, msg io.WriterTo) error {
+		buf := new(bytes.Buffer)
+		if _, err := msg.WriteTo(buf); err != nil {
+			return err
+		}
+		got = buf.String()
+		return nil
+	}), signer)
+
+	if err := Send(s, getTestMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed; d=example.com; s=mail;\r\n") {
+		t.Errorf("Invalid signed message:\n%s", got)
+	}
+}
+
+func TestDKIMSenderTransport(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &DKIMSigner{Domain: "example.com", Selector: "mail", Signer: priv}
+
+	m := NewMessage()
+	m.SetHeader("From", "from@example.com")
+	m.SetHeader("To", "to@example.com")
+	m.SetHeader("Subject", "¡Hola, señor!")
+	m.SetBody("text/plain", "¡Hola, señor!", SetPartEncoding(Unencoded))
+
+	var got []byte
+	s := NewDKIMSender(SendFunc(func(from string, to []string, msg io.WriterTo) error {
+		signed, ok := msg.(*Message)
+		if !ok {
+			return fmt.Errorf("msg is a %T, want a *Message", msg)
+		}
+		// The message is encoded for an SMTP server without 8BITMIME.
+		buf := new(bytes.Buffer)
+		if _, err := signed.writeTo(buf, transport{sevenBit: true, noBinary: true}); err != nil {
+			return err
+		}
+		got = buf.Bytes()
+		return nil
+	}), signer)
+
+	if err := Send(s, m); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(got, []byte("Content-Transfer-Encoding: quoted-printable\r\n")) {
+		t.Errorf("The body should be encoded in quoted-printable:\n%s", got)
+	}
+	verifyDKIM(t, got, func(digest, sig []byte) bool {
+		return ed25519.Verify(pub, digest, sig)
+	})
+	if m.dkim != nil {
+		t.Error("NewDKIMSender should not modify the message")
+	}
+}
+
+func writeDKIMMessage(t *testing.T, s *DKIMSigner) []byte {
+	m := NewMessage(SetDKIM(s))
+	m.SetHeader("From", "from@example.com")
+	m.SetHeader("To", "to@example.com")
+	m.SetHeader("Subject", "¡Hola, señor!")
+	m.SetBody("text/plain", "¡Hola, señor!")
+	m.AddAlternative("text/html", "<p>¡Hola, señor!</p>")
+
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+var dkimBRegExp = regexp.MustCompile(`b=[A-Za-z0-9+/=\r\n ]*$`)
+
+// verifyDKIM verifies the DKIM signature at the top of msg.
+func verifyDKIM(t *testing.T, msg []byte, verify func(digest, sig []byte) bool) {
+	header, body := splitMessage(msg)
+	fields := parseHeaderFields(header)
+	sigField := fields[0]
+	if sigField.name != "DKIM-Signature" {
+		t.Fatalf("The first header field should be DKIM-Signature, got %q", sigField.name)
+	}
+
+	tags := make(map[string]string)
+	value := strings.TrimPrefix(strings.TrimSuffix(sigField.raw, "\r\n"), "DKIM-Signature:")
+	for _, tag := range strings.Split(value, ";") {
+		tag = strings.Join(strings.Fields(tag), "")
+		if i := strings.IndexByte(tag, '='); i != -1 {
+			tags[tag[:i]] = tag[i+1:]
+		}
+	}
+
+	c := strings.Split(tags["c"], "/")
+	hc, bc := Canonicalization(c[0]), Canonicalization(c[1])
+
+	bodyHash := sha256.Sum256(canonicalBody(body, bc))
+	if got := base64.StdEncoding.EncodeToString(bodyHash[:]); got != tags["bh"] {
+		t.Errorf("Invalid body hash, got %q, want %q", tags["bh"], got)
+	}
+
+	h := sha256.New()
+	used := make(map[int]bool)
+	for _, name := range strings.Split(tags["h"], ":") {
+		for i := len(fields) - 1; i > 0; i-- {
+			if !used[i] && strings.EqualFold(fields[i].name, name) {
+				used[i] = true
+				io.WriteString(h, canonicalHeader(fields[i], hc))
+				break
+			}
+		}
+	}
+	unsigned := headerField{
+		name: sigField.name,
+		raw:  dkimBRegExp.ReplaceAllString(strings.TrimSuffix(sigField.raw, "\r\n"), "b=") + "\r\n",
+	}
+	io.WriteString(h, strings.TrimSuffix(canonicalHeader(unsigned, hc), "\r\n"))
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verify(h.Sum(nil), sig) {
+		t.Errorf("Invalid DKIM signature:\n%s", msg)
+	}
+	for _, name := range []string{"from", "to", "subject", "content-type"} {
+		if !strings.Contains(strings.ToLower(tags["h"]), name) {
+			t.Errorf("Field %q is not signed: h=%s", name, tags["h"])
+		}
+	}
+}
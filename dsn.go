@@ -0,0 +1,142 @@
+package gomail
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DSNNotify is a set of conditions in which a delivery status notification is
+// requested for a recipient, as defined in RFC 3461.
+type DSNNotify uint8
+
+const (
+	// NotifySuccess requests a notification when the email is delivered.
+	NotifySuccess DSNNotify = 1 << iota
+	// NotifyFailure requests a notification when the email cannot be
+	// delivered.
+	NotifyFailure
+	// NotifyDelay requests a notification when the delivery of the email is
+	// delayed.
+	NotifyDelay
+	// NotifyNever requests that no notification is sent. It cannot be
+	// combined with other conditions.
+	NotifyNever
+)
+
+func (n DSNNotify) String() string {
+	if n&NotifyNever != 0 {
+		return "NEVER"
+	}
+	var conditions []string
+	if n&NotifySuccess != 0 {
+		conditions = append(conditions, "SUCCESS")
+	}
+	if n&NotifyFailure != 0 {
+		conditions = append(conditions, "FAILURE")
+	}
+	if n&NotifyDelay != 0 {
+		conditions = append(conditions, "DELAY")
+	}
+	return strings.Join(conditions, ",")
+}
+
+// DSNReturn defines which part of the email is returned in a failure
+// notification.
+type DSNReturn string
+
+const (
+	// ReturnFull returns the full email.
+	ReturnFull DSNReturn = "FULL"
+	// ReturnHeaders returns only the header of the email.
+	ReturnHeaders DSNReturn = "HDRS"
+)
+
+// DSNOptions are the delivery status notification parameters of an email. They
+// are only sent if the SMTP server supports the DSN extension.
+type DSNOptions struct {
+	// Notify defines when notifications are requested for the recipients of
+	// the email. By default, the SMTP server decides, usually on failure and
+	// delay.
+	Notify DSNNotify
+	// Return defines which part of the email is returned in a failure
+	// notification. By default, the SMTP server decides.
+	Return DSNReturn
+	// EnvelopeID is an identifier of the email returned in the notifications.
+	EnvelopeID string
+}
+
+type recipientDSN struct {
+	notify   DSNNotify
+	original string
+}
+
+// SetDSN requests delivery status notifications for the message.
+func (m *Message) SetDSN(o DSNOptions) {
+	m.dsn = &o
+}
+
+// SetRecipientDSN sets the delivery status notification parameters of a
+// recipient of the message. notify overrides DSNOptions.Notify if it is not
+// zero and original is the original address of the recipient, e.g. before
+// alias expansion, returned in the notifications if not empty.
+func (m *Message) SetRecipientDSN(address string, notify DSNNotify, original string) {
+	if m.rcptDSN == nil {
+		m.rcptDSN = make(map[string]recipientDSN)
+	}
+	m.rcptDSN[address] = recipientDSN{notify: notify, original: original}
+}
+
+// hasDSN returns whether delivery status notifications are requested.
+func (m *Message) hasDSN() bool {
+	return m.dsn != nil || len(m.rcptDSN) > 0
+}
+
+// dsnMailParams returns the DSN parameters of the MAIL command.
+func (m *Message) dsnMailParams() []string {
+	if m.dsn == nil {
+		return nil
+	}
+	var params []string
+	if m.dsn.Return != "" {
+		params = append(params, "RET="+string(m.dsn.Return))
+	}
+	if m.dsn.EnvelopeID != "" {
+		params = append(params, "ENVID="+xtext(m.dsn.EnvelopeID))
+	}
+	return params
+}
+
+// dsnRcptParams returns the DSN parameters of the RCPT command of addr.
+func (m *Message) dsnRcptParams(addr string) []string {
+	var notify DSNNotify
+	if m.dsn != nil {
+		notify = m.dsn.Notify
+	}
+	r, ok := m.rcptDSN[addr]
+	if ok && r.notify != 0 {
+		notify = r.notify
+	}
+
+	var params []string
+	if notify != 0 {
+		params = append(params, "NOTIFY="+notify.String())
+	}
+	if ok && r.original != "" {
+		params = append(params, "ORCPT=rfc822;"+xtext(r.original))
+	}
+	return params
+}
+
+// xtext encodes s as defined in RFC 3461, section 4.
+func xtext(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '!' || c > '~' || c == '+' || c == '=' {
+			fmt.Fprintf(&b, "+%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
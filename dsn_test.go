@@ -0,0 +1,138 @@
+package gomail
+
+import (
+	"net"
+	"net/textproto"
+	"reflect"
+	"testing"
+)
+
+func getDSNMessage() *Message {
+	m := getTestMessage()
+	m.SetDSN(DSNOptions{
+		Notify:     NotifySuccess | NotifyFailure,
+		Return:     ReturnHeaders,
+		EnvelopeID: "id 1+2",
+	})
+	m.SetRecipientDSN(testTo2, NotifyNever, "orig@example.com")
+	return m
+}
+
+func TestDialerDSN(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Extension DSN",
+			"Mail " + testFrom + " RET=HDRS ENVID=id+201+2B2",
+			"Rcpt " + testTo1 + " NOTIFY=SUCCESS,FAILURE",
+			"Rcpt " + testTo2 + " NOTIFY=NEVER ORCPT=rfc822;orig@example.com",
+			"Data",
+			"Write message",
+			"Close writer",
+			"Quit",
+			"Close",
+		},
+		addr: addr(d.Host, d.Port),
+	}
+	stubDial(t, testClient)
+
+	if err := d.DialAndSend(getDSNMessage()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDialerDSNUnsupported(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Extension DSN",
+			"Mail " + testFrom,
+			"Rcpt " + testTo1,
+			"Rcpt " + testTo2,
+			"Data",
+			"Write message",
+			"Close writer",
+			"Quit",
+			"Close",
+		},
+		addr:        addr(d.Host, d.Port),
+		unsupported: map[string]bool{"DSN": true},
+	}
+	stubDial(t, testClient)
+
+	if err := d.DialAndSend(getDSNMessage()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientParams(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	lines := make(chan []string, 1)
+	go func() {
+		var got []string
+		defer func() { lines <- got }()
+
+		conn := textproto.NewConn(server)
+		conn.PrintfLine("220 %s ESMTP", testHost)
+		for _, reply := range []string{
+			"250-" + testHost + "\r\n250-8BITMIME\r\n250 DSN",
+			"250 OK",
+			"250 OK",
+			"250 OK",
+		} {
+			line, err := conn.ReadLine()
+			if err != nil {
+				return
+			}
+			got = append(got, line)
+			conn.PrintfLine("%s", reply)
+		}
+	}()
+
+	c, err := realSMTPNewClient(client, testHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Hello("localhost"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Mail(testFrom, "RET=HDRS"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Rcpt(testTo1, "NOTIFY=NEVER"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Rcpt(testTo2, "NOTIFY=NEVER\r\nDATA"); err == nil {
+		t.Error("Rcpt() should fail when a parameter contains CRLF")
+	}
+	if err := c.Rcpt(testTo2); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	want := []string{
+		"EHLO localhost",
+		"MAIL FROM:<" + testFrom + "> RET=HDRS",
+		"RCPT TO:<" + testTo1 + "> NOTIFY=NEVER",
+		"RCPT TO:<" + testTo2 + ">",
+	}
+	if got := <-lines; !reflect.DeepEqual(got, want) {
+		t.Errorf("Invalid commands, got %q, want %q", got, want)
+	}
+}
+
+func TestXText(t *testing.T) {
+	if got, want := xtext("a+b=c d\xc3\xa9"), "a+2Bb+3Dc+20d+C3+A9"; got != want {
+		t.Errorf("xtext() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,93 @@
+package gomail
+
+import (
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// An SMTPError is an error reply sent by the SMTP server.
+//
+// The errors returned by Send, Dial and the Sender returned by Dial wrap an
+// SMTPError when the SMTP server replies with an error so it can be retrieved
+// with errors.As.
+type SMTPError struct {
+	// Code is the three-digit reply code, e.g. 550.
+	Code int
+	// EnhancedCode is the enhanced status code as defined in RFC 3463, e.g.
+	// "5.1.1". It is empty if the SMTP server did not send one.
+	EnhancedCode string
+	// Message is the text of the reply without the enhanced status code.
+	Message string
+	// Command is the SMTP command that failed, e.g. "RCPT". It is "greeting"
+	// if the server refused the connection and "message transfer" if it
+	// rejected the content of the email.
+	Command string
+}
+
+func newSMTPError(command string, err *textproto.Error) *SMTPError {
+	e := &SMTPError{
+		Code:    err.Code,
+		Message: err.Msg,
+		Command: command,
+	}
+
+	// Multiline replies are joined with newlines and each line starts with
+	// the same enhanced status code.
+	lines := strings.Split(err.Msg, "\n")
+	code := enhancedCode(lines[0], err.Code)
+	if code == "" {
+		return e
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(strings.TrimPrefix(line, code), " ")
+	}
+	e.EnhancedCode = code
+	e.Message = strings.Join(lines, "\n")
+	return e
+}
+
+// enhancedCode returns the enhanced status code at the beginning of s or an
+// empty string if there is none. Its class must match the one of the reply
+// code.
+func enhancedCode(s string, code int) string {
+	i := strings.IndexByte(s, ' ')
+	if i == -1 {
+		i = len(s)
+	}
+	parts := strings.Split(s[:i], ".")
+	if len(parts) != 3 || parts[0] != strconv.Itoa(code/100) {
+		return ""
+	}
+	for _, p := range parts[1:] {
+		if len(p) == 0 || len(p) > 3 {
+			return ""
+		}
+		for j := 0; j < len(p); j++ {
+			if p[j] < '0' || p[j] > '9' {
+				return ""
+			}
+		}
+	}
+	return s[:i]
+}
+
+func (e *SMTPError) Error() string {
+	s := "gomail: " + e.Command + " failed: " + strconv.Itoa(e.Code)
+	if e.EnhancedCode != "" {
+		s += " " + e.EnhancedCode
+	}
+	return s + " " + e.Message
+}
+
+// Temporary returns whether the error is a transient negative completion
+// reply (4xx). The same command may succeed if it is tried again later.
+func (e *SMTPError) Temporary() bool {
+	return e.Code >= 400 && e.Code < 500
+}
+
+// Permanent returns whether the error is a permanent negative completion reply
+// (5xx). The same command should not be tried again.
+func (e *SMTPError) Permanent() bool {
+	return e.Code >= 500 && e.Code < 600
+}
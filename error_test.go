@@ -0,0 +1,78 @@
+package gomail
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"testing"
+)
+
+func TestSMTPError(t *testing.T) {
+	tests := []struct {
+		err       *textproto.Error
+		want      SMTPError
+		temporary bool
+		permanent bool
+	}{
+		{
+			err:       &textproto.Error{Code: 550, Msg: "5.1.1 No such user"},
+			want:      SMTPError{Code: 550, EnhancedCode: "5.1.1", Message: "No such user", Command: "RCPT"},
+			permanent: true,
+		},
+		{
+			err:       &textproto.Error{Code: 451, Msg: "4.7.1 Greylisted\n4.7.1 Try again later"},
+			want:      SMTPError{Code: 451, EnhancedCode: "4.7.1", Message: "Greylisted\nTry again later", Command: "RCPT"},
+			temporary: true,
+		},
+		{
+			err:       &textproto.Error{Code: 554, Msg: "Transaction failed"},
+			want:      SMTPError{Code: 554, Message: "Transaction failed", Command: "RCPT"},
+			permanent: true,
+		},
+		{
+			err:       &textproto.Error{Code: 550, Msg: "4.1.1 Class mismatch"},
+			want:      SMTPError{Code: 550, Message: "4.1.1 Class mismatch", Command: "RCPT"},
+			permanent: true,
+		},
+	}
+
+	for _, test := range tests {
+		got := newSMTPError("RCPT", test.err)
+		if *got != test.want {
+			t.Errorf("newSMTPError(%q) = %#v, want %#v", test.err.Msg, *got, test.want)
+		}
+		if got.Temporary() != test.temporary {
+			t.Errorf("Temporary() = %v for %q, want %v", got.Temporary(), test.err.Msg, test.temporary)
+		}
+		if got.Permanent() != test.permanent {
+			t.Errorf("Permanent() = %v for %q, want %v", got.Permanent(), test.err.Msg, test.permanent)
+		}
+	}
+}
+
+func TestSMTPErrorAs(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Mail " + testFrom,
+			"Rcpt " + testTo1,
+			"Quit",
+		},
+		addr:     addr(d.Host, d.Port),
+		rejected: map[string]bool{testTo1: true},
+	}
+	stubDial(t, testClient)
+
+	err := d.DialAndSendContext(context.Background(), getTestMessage())
+	var smtpErr *SMTPError
+	if !errors.As(err, &smtpErr) {
+		t.Fatalf("DialAndSend() = %v, want an *SMTPError", err)
+	}
+	if smtpErr.Code != 550 || smtpErr.Command != "RCPT" || !smtpErr.Permanent() {
+		t.Errorf("Invalid error, got %#v", smtpErr)
+	}
+}
@@ -1,10 +1,12 @@
 package gomail_test
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"io"
 	"log"
+	"strings"
 	"time"
 
 	"gopkg.in/gomail.v2"
@@ -99,6 +101,52 @@ func Example_newsletter() {
 	}
 }
 
+// Send an email but give up if it takes more than 30 seconds.
+func Example_context() {
+	m := gomail.NewMessage()
+	m.SetHeader("From", "from@example.com")
+	m.SetHeader("To", "to@example.com")
+	m.SetHeader("Subject", "Hello!")
+	m.SetBody("text/plain", "Hello!")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	d := gomail.NewDialer("smtp.example.com", 587, "user", "123456")
+	if err := d.DialAndSendContext(ctx, m); err != nil {
+		panic(err)
+	}
+}
+
+// Share a pool of SMTP connections between several goroutines.
+func Example_pool() {
+	d := gomail.NewDialer("smtp.example.com", 587, "user", "123456")
+	p := gomail.NewPool(d)
+	p.MaxOpen = 5
+	defer p.Close()
+
+	ch := make(chan *gomail.Message)
+	done := make(chan bool)
+	for i := 0; i < 5; i++ {
+		go func() {
+			for m := range ch {
+				if err := gomail.Send(p, m); err != nil {
+					log.Print(err)
+				}
+			}
+			done <- true
+		}()
+	}
+
+	// Use the channel in your program to send emails.
+
+	// Close the channel and wait for the workers to stop.
+	close(ch)
+	for i := 0; i < 5; i++ {
+		<-done
+	}
+}
+
 // Send an email using a local SMTP server.
 func Example_noAuth() {
 	m := gomail.NewMessage()
@@ -171,6 +219,10 @@ func ExampleMessage_Attach() {
 	m.Attach("/tmp/image.jpg")
 }
 
+func ExampleMessage_AttachReader() {
+	m.AttachReader("report.csv", strings.NewReader("id,name\n1,Bob\n"))
+}
+
 func ExampleMessage_Embed() {
 	m.Embed("/tmp/image.jpg")
 	m.SetBody("text/html", `<img src="cid:image.jpg" alt="My image" />`)
@@ -186,6 +238,13 @@ func ExampleMessage_FormatDate() {
 	})
 }
 
+func ExampleMessage_MessageID() {
+	d := gomail.NewDialer("smtp.example.com", 587, "user", "123456")
+	if err := d.DialAndSend(m); err != nil {
+		log.Printf("Could not send email %s: %v", m.MessageID(), err)
+	}
+}
+
 func ExampleMessage_SetAddressHeader() {
 	m.SetAddressHeader("To", "bob@example.com", "Bob")
 }
@@ -221,3 +280,7 @@ func ExampleSetEncoding() {
 func ExampleSetPartEncoding() {
 	m.SetBody("text/plain", "Hello!", gomail.SetPartEncoding(gomail.Unencoded))
 }
+
+func ExampleSetPlainTextAlternative() {
+	m.SetBody("text/html", `<p>Hello <a href="https://example.com/">Bob</a>!</p>`, gomail.SetPlainTextAlternative())
+}
@@ -0,0 +1,35 @@
+//go:build go1.16
+// +build go1.16
+
+package gomail
+
+import (
+	"io"
+	"io/fs"
+	"path"
+)
+
+// AttachFS attaches the file at the given path of fsys, e.g. an embed.FS.
+func (m *Message) AttachFS(fsys fs.FS, name string, settings ...FileSetting) {
+	m.attachments = m.appendFile(m.attachments, name, fsSettings(fsys, name, settings))
+}
+
+// EmbedFS embeds the image at the given path of fsys, e.g. an embed.FS.
+func (m *Message) EmbedFS(fsys fs.FS, name string, settings ...FileSetting) {
+	m.embedded = m.appendFile(m.embedded, name, fsSettings(fsys, name, settings))
+}
+
+func fsSettings(fsys fs.FS, name string, settings []FileSetting) []FileSetting {
+	copyFunc := func(w io.Writer) error {
+		h, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, h); err != nil {
+			h.Close()
+			return err
+		}
+		return h.Close()
+	}
+	return append([]FileSetting{Rename(path.Base(name)), SetCopyFunc(copyFunc)}, settings...)
+}
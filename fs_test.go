@@ -0,0 +1,71 @@
+//go:build go1.16
+// +build go1.16
+
+package gomail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAttachFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"files/test.pdf":  {Data: []byte("Content of test.pdf")},
+		"files/image.jpg": {Data: []byte("Content of image.jpg")},
+	}
+
+	m := NewMessage()
+	m.SetHeader("From", "from@example.com")
+	m.SetHeader("To", "to@example.com")
+	m.SetBody("text/plain", "Test")
+	m.AttachFS(fsys, "files/test.pdf")
+	m.EmbedFS(fsys, "files/image.jpg")
+
+	want := &message{
+		from: "from@example.com",
+		to:   []string{"to@example.com"},
+		content: "From: from@example.com\r\n" +
+			"To: to@example.com\r\n" +
+			"Content-Type: multipart/mixed;\r\n" +
+			" boundary=_BOUNDARY_1_\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: multipart/related;\r\n" +
+			" boundary=_BOUNDARY_2_\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_2_\r\n" +
+			"Content-Type: text/plain; charset=UTF-8\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"Test\r\n" +
+			"--_BOUNDARY_2_\r\n" +
+			"Content-Type: image/jpeg; name=\"image.jpg\"\r\n" +
+			"Content-Disposition: inline; filename=\"image.jpg\"\r\n" +
+			"Content-ID: <image.jpg>\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			base64.StdEncoding.EncodeToString([]byte("Content of image.jpg")) + "\r\n" +
+			"--_BOUNDARY_2_--\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: application/pdf; name=\"test.pdf\"\r\n" +
+			"Content-Disposition: attachment; filename=\"test.pdf\"\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			base64.StdEncoding.EncodeToString([]byte("Content of test.pdf")) + "\r\n" +
+			"--_BOUNDARY_1_--\r\n",
+	}
+
+	testMessage(t, m, 2, want)
+}
+
+func TestAttachFSNotFound(t *testing.T) {
+	m := NewMessage()
+	m.SetBody("text/plain", "Test")
+	m.AttachFS(fstest.MapFS{}, "test.pdf")
+	if _, err := m.WriteTo(new(bytes.Buffer)); err == nil {
+		t.Error("WriteTo() should fail when the file does not exist")
+	}
+}
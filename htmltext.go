@@ -0,0 +1,445 @@
+package gomail
+
+import (
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SetPlainTextAlternative is a PartSetting for text/html parts. If the message
+// has no text/plain part when it is written, a plain text version of the HTML
+// part is derived and added as the first alternative.
+//
+// Headings, lists, tables and quotes are kept readable and the targets of the
+// links are listed as footnotes at the end of the text.
+func SetPlainTextAlternative() PartSetting {
+	return PartSetting(func(p *part) {
+		p.textAlternative = true
+	})
+}
+
+// bodyParts returns the parts of the message, including the plain text part
+// derived from an HTML part set with SetPlainTextAlternative.
+func (m *Message) bodyParts() []*part {
+	var htmlPart *part
+	for _, p := range m.parts {
+		switch p.contentType {
+		case "text/plain":
+			return m.parts
+		case "text/html":
+			if p.textAlternative && htmlPart == nil {
+				htmlPart = p
+			}
+		}
+	}
+	if htmlPart == nil {
+		return m.parts
+	}
+
+	text := &part{
+		contentType: "text/plain",
+		encoding:    htmlPart.encoding,
+		charset:     htmlPart.charset,
+		copier: func(w io.Writer) error {
+			content, err := htmlPart.content()
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, htmlToText(content))
+			return err
+		},
+	}
+	return append([]*part{text}, m.parts...)
+}
+
+// htmlToText converts an HTML document to plain text.
+func htmlToText(s string) string {
+	w := &textWriter{lineStart: true}
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i == -1 {
+			w.text(s)
+			break
+		}
+		w.text(s[:i])
+		s = s[i:]
+
+		switch {
+		case strings.HasPrefix(s, "<!--"):
+			s = skipPast(s, "-->")
+		case len(s) > 1 && (s[1] == '!' || s[1] == '?'):
+			s = skipPast(s, ">")
+		default:
+			t, rest, ok := parseHTMLTag(s)
+			if !ok {
+				w.text("<")
+				s = s[1:]
+				continue
+			}
+			s = rest
+			switch t.name {
+			case "script", "style", "title", "textarea":
+				// Their content is not HTML.
+				if !t.end {
+					s = skipRawText(s, t.name)
+				}
+				continue
+			}
+			w.tag(t)
+		}
+	}
+	return w.finish()
+}
+
+// skipPast returns s after the first occurrence of sep, or an empty string if
+// sep is not found.
+func skipPast(s, sep string) string {
+	i := strings.Index(s, sep)
+	if i == -1 {
+		return ""
+	}
+	return s[i+len(sep):]
+}
+
+// skipRawText returns s after the end tag of the element name.
+func skipRawText(s, name string) string {
+	i := strings.Index(strings.ToLower(s), "</"+name)
+	if i == -1 {
+		return ""
+	}
+	return skipPast(s[i:], ">")
+}
+
+type htmlTag struct {
+	name  string
+	end   bool
+	attrs map[string]string
+}
+
+// parseHTMLTag parses the tag at the beginning of s and returns the rest of s.
+func parseHTMLTag(s string) (t htmlTag, rest string, ok bool) {
+	i := 1
+	if i < len(s) && s[i] == '/' {
+		t.end = true
+		i++
+	}
+	start := i
+	for i < len(s) && isHTMLNameByte(s[i]) {
+		i++
+	}
+	if i == start || !isLetter(s[start]) {
+		return t, s, false
+	}
+	t.name = strings.ToLower(s[start:i])
+
+	for i < len(s) && s[i] != '>' {
+		if isHTMLSpace(s[i]) || s[i] == '/' {
+			i++
+			continue
+		}
+		start = i
+		for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '=' && s[i] != '>' && s[i] != '/' {
+			i++
+		}
+		name := strings.ToLower(s[start:i])
+		for i < len(s) && isHTMLSpace(s[i]) {
+			i++
+		}
+		value := ""
+		if i < len(s) && s[i] == '=' {
+			i++
+			for i < len(s) && isHTMLSpace(s[i]) {
+				i++
+			}
+			if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+				quote := s[i]
+				i++
+				start = i
+				for i < len(s) && s[i] != quote {
+					i++
+				}
+				value = s[start:i]
+				if i < len(s) {
+					i++
+				}
+			} else {
+				start = i
+				for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '>' {
+					i++
+				}
+				value = s[start:i]
+			}
+		}
+		if t.attrs == nil {
+			t.attrs = make(map[string]string)
+		}
+		if _, ok := t.attrs[name]; !ok && name != "" {
+			t.attrs[name] = html.UnescapeString(value)
+		}
+	}
+	if i < len(s) {
+		i++
+	}
+	return t, s[i:], true
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isHTMLNameByte(c byte) bool {
+	return isLetter(c) || '0' <= c && c <= '9' || c == '-' || c == ':'
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+type textList struct {
+	ordered bool
+	n       int
+}
+
+// textWriter writes the plain text version of an HTML document.
+type textWriter struct {
+	b strings.Builder
+	// breaks is the number of line breaks to write before the next text.
+	breaks    int
+	space     bool
+	lineStart bool
+	// skip is true inside the head element.
+	skip   bool
+	pre    int
+	quotes int
+	// lineQuotes is the quote level of the current line.
+	lineQuotes int
+	lists      []textList
+	marker     string
+	cells      int
+
+	links     []string
+	href      string
+	linkStart int
+}
+
+func (w *textWriter) tag(t htmlTag) {
+	switch t.name {
+	case "head":
+		w.skip = !t.end
+	case "body":
+		w.skip = false
+	case "br":
+		w.breaks++
+		w.space = false
+	case "p", "table":
+		w.block(2)
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		w.block(2)
+		if !t.end {
+			w.write(strings.Repeat("#", int(t.name[1]-'0')))
+			w.space = true
+		}
+	case "pre":
+		w.block(2)
+		if !t.end {
+			w.pre++
+		} else if w.pre > 0 {
+			w.pre--
+		}
+	case "blockquote":
+		w.block(2)
+		if !t.end {
+			w.quotes++
+		} else if w.quotes > 0 {
+			w.quotes--
+		}
+	case "hr":
+		w.block(2)
+		w.write("----------")
+		w.block(2)
+	case "ul", "ol":
+		if !t.end {
+			w.block(1)
+			w.lists = append(w.lists, textList{ordered: t.name == "ol"})
+		} else if len(w.lists) > 0 {
+			w.lists = w.lists[:len(w.lists)-1]
+		}
+		if len(w.lists) == 0 {
+			w.block(2)
+		} else {
+			w.block(1)
+		}
+	case "li":
+		w.block(1)
+		if !t.end && len(w.lists) > 0 {
+			l := &w.lists[len(w.lists)-1]
+			l.n++
+			if l.ordered {
+				w.marker = strconv.Itoa(l.n) + ". "
+			} else {
+				w.marker = "* "
+			}
+		}
+	case "tr":
+		w.block(1)
+		w.cells = 0
+	case "td", "th":
+		if !t.end {
+			if w.cells > 0 {
+				w.space = true
+				w.write("|")
+				w.space = true
+			}
+			w.cells++
+		}
+	case "a":
+		if !t.end {
+			w.href = t.attrs["href"]
+			w.linkStart = w.b.Len()
+		} else {
+			w.endLink()
+		}
+	case "img":
+		w.text(t.attrs["alt"])
+	case "div", "dl", "dt", "dd", "section", "article", "header", "footer",
+		"nav", "aside", "main", "form", "fieldset", "address", "figure",
+		"figcaption", "center", "caption":
+		w.block(1)
+	}
+}
+
+// endLink adds the target of the current link to the footnotes, unless it is
+// already the text of the link.
+func (w *textWriter) endLink() {
+	href := w.href
+	w.href = ""
+	if href == "" || strings.HasPrefix(href, "#") ||
+		strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return
+	}
+	text := strings.TrimSpace(w.b.String()[w.linkStart:])
+	if text == href || "mailto:"+text == href {
+		return
+	}
+
+	n := 0
+	for i, l := range w.links {
+		if l == href {
+			n = i + 1
+			break
+		}
+	}
+	if n == 0 {
+		w.links = append(w.links, href)
+		n = len(w.links)
+	}
+	w.space = text != ""
+	w.write("[" + strconv.Itoa(n) + "]")
+}
+
+// block ends the current line and makes sure that the next text is written
+// after n line breaks.
+func (w *textWriter) block(n int) {
+	if n > w.breaks {
+		w.breaks = n
+	}
+	w.space = false
+}
+
+// text writes a text node.
+func (w *textWriter) text(s string) {
+	if w.skip || s == "" {
+		return
+	}
+	s = html.UnescapeString(s)
+
+	if w.pre > 0 {
+		s = strings.Replace(s, "\r\n", "\n", -1)
+		for i, line := range strings.Split(s, "\n") {
+			if i > 0 {
+				w.breaks++
+			}
+			if line != "" {
+				w.space = false
+				w.write(line)
+			}
+		}
+		return
+	}
+
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return r < 0x80 && isHTMLSpace(byte(r))
+	})
+	if isHTMLSpace(s[0]) {
+		w.space = true
+	}
+	for i, word := range words {
+		if i > 0 {
+			w.space = true
+		}
+		w.write(strings.Replace(word, "\u00a0", " ", -1))
+	}
+	if len(words) > 0 && isHTMLSpace(s[len(s)-1]) {
+		w.space = true
+	}
+}
+
+// write writes s on the current line, after the pending line breaks and the
+// prefix of the line if needed.
+func (w *textWriter) write(s string) {
+	if w.breaks > 0 && w.b.Len() > 0 {
+		// Blank lines only belong to a quote if the lines around them do.
+		quotes := w.quotes
+		if w.lineQuotes < quotes {
+			quotes = w.lineQuotes
+		}
+		w.b.WriteString("\r\n")
+		for i := 1; i < w.breaks; i++ {
+			w.b.WriteString(strings.TrimRight(strings.Repeat("> ", quotes), " "))
+			w.b.WriteString("\r\n")
+		}
+		w.lineStart = true
+	}
+	w.breaks = 0
+
+	if w.lineStart {
+		w.lineQuotes = w.quotes
+		w.b.WriteString(w.prefix())
+		w.lineStart = false
+	} else if w.space {
+		w.b.WriteByte(' ')
+	}
+	w.space = false
+	w.b.WriteString(s)
+}
+
+// prefix returns the prefix of a new line: the quote markers and the
+// indentation or marker of the current list item.
+func (w *textWriter) prefix() string {
+	p := strings.Repeat("> ", w.quotes)
+	if len(w.lists) > 0 {
+		p += strings.Repeat("  ", len(w.lists)-1)
+		if w.marker != "" {
+			p += w.marker
+			w.marker = ""
+		} else {
+			p += "  "
+		}
+	}
+	return p
+}
+
+// finish writes the footnotes and returns the text.
+func (w *textWriter) finish() string {
+	w.quotes, w.lists, w.pre = 0, nil, 0
+	for i, l := range w.links {
+		if i == 0 {
+			w.block(2)
+		} else {
+			w.block(1)
+		}
+		w.write("[" + strconv.Itoa(i+1) + "] " + l)
+	}
+	return w.b.String()
+}
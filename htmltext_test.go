@@ -0,0 +1,103 @@
+package gomail
+
+import (
+	"testing"
+)
+
+func TestPlainTextAlternative(t *testing.T) {
+	m := NewMessage()
+	m.SetHeader("From", "from@example.com")
+	m.SetHeader("To", "to@example.com")
+	m.SetBody("text/html", "<p>¡<b>Hola</b>, <a href=\"https://example.com/\">señor</a>!</p>",
+		SetPlainTextAlternative())
+
+	want := &message{
+		from: "from@example.com",
+		to:   []string{"to@example.com"},
+		content: "From: from@example.com\r\n" +
+			"To: to@example.com\r\n" +
+			"Content-Type: multipart/alternative;\r\n" +
+			" boundary=_BOUNDARY_1_\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: text/plain; charset=UTF-8\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"=C2=A1Hola, se=C3=B1or [1]!\r\n" +
+			"\r\n" +
+			"[1] https://example.com/\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: text/html; charset=UTF-8\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"<p>=C2=A1<b>Hola</b>, <a href=3D\"https://example.com/\">se=C3=B1or</a>!</p>\r\n" +
+			"--_BOUNDARY_1_--\r\n",
+	}
+
+	testMessage(t, m, 1, want)
+}
+
+func TestPlainTextAlternativeExisting(t *testing.T) {
+	m := NewMessage()
+	m.SetBody("text/html", "<p>Hello</p>", SetPlainTextAlternative())
+	if got := m.bodyParts(); len(got) != 2 || got[0].contentType != "text/plain" {
+		t.Fatalf("Invalid parts: %v", got)
+	}
+
+	m.AddAlternative("text/plain", "Hi")
+	if got := m.bodyParts(); len(got) != 2 || got[0].contentType != "text/html" {
+		t.Errorf("The text/plain part should not be replaced: %v", got)
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		html, text string
+	}{
+		{
+			"<html><head><title>Title</title><style>p { color: red; }</style></head>" +
+				"<body>\n  <p>Hello,\n  world!</p><p>Bye.</p></body></html>",
+			"Hello, world!\r\n\r\nBye.",
+		},
+		{
+			"<h1>Title</h1><h2>Sub&shy;title</h2>Text<br>Line<br><br>Paragraph",
+			"# Title\r\n\r\n## Sub­title\r\n\r\nText\r\nLine\r\n\r\nParagraph",
+		},
+		{
+			"<ul><li>One</li><li>Two<ol><li>A</li><li>B</li></ol></li></ul><p>End</p>",
+			"* One\r\n* Two\r\n  1. A\r\n  2. B\r\n\r\nEnd",
+		},
+		{
+			"<table><tr><th>Name</th><th>Price</th></tr>" +
+				"<tr><td>Tea</td><td>2&nbsp;&euro;</td></tr></table>",
+			"Name | Price\r\nTea | 2 €",
+		},
+		{
+			"Visit <a href=\"https://example.com/a\">our site</a> or " +
+				"<a href='https://example.com/a'>this one</a>, " +
+				"<a href=\"https://example.com/\">https://example.com/</a>, " +
+				"<a href=\"mailto:me@example.com\">me@example.com</a> and " +
+				"<a href=\"#top\">the top</a>.<img src=\"a.png\" alt=\" Logo\">",
+			"Visit our site [1] or this one [1], https://example.com/, " +
+				"me@example.com and the top. Logo\r\n" +
+				"\r\n" +
+				"[1] https://example.com/a",
+		},
+		{
+			"<p>Quote:</p><blockquote><p>First</p><p>Second</p></blockquote>" +
+				"<pre>  a\n  b</pre><hr>1 &lt; 2<!-- comment -->",
+			"Quote:\r\n\r\n> First\r\n>\r\n> Second\r\n\r\n  a\r\n  b\r\n\r\n" +
+				"----------\r\n\r\n1 < 2",
+		},
+		{
+			"a < b <3 <script>if (a < b) {}</script>",
+			"a < b <3",
+		},
+	}
+
+	for _, test := range tests {
+		if got := htmlToText(test.html); got != test.text {
+			t.Errorf("htmlToText(%q) = %q, want %q", test.html, got, test.text)
+		}
+	}
+}
@@ -2,9 +2,15 @@ package gomail
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"io"
+	"net/mail"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,14 +24,50 @@ type Message struct {
 	encoding    Encoding
 	hEncoder    mimeEncoder
 	buf         bytes.Buffer
+	dkim        *DKIMSigner
+	wrappers    []entityWrapper
+	boundary    func() string
+	headerOrder []string
+	idDomain    string
+	// idToken is the unique part of the generated Message-ID.
+	idToken string
+	// envelopeFrom and envelopeTo override the envelope derived from the
+	// header when they are set.
+	envelopeFrom string
+	envelopeTo   []string
+	dsn          *DSNOptions
+	rcptDSN      map[string]recipientDSN
+	// repeatedFields holds the header fields appearing several times in a
+	// message read by ReadMessage. Each of their values is written as a
+	// distinct field instead of being joined with commas.
+	repeatedFields map[string]bool
 }
 
 type header map[string][]string
 
+// with returns a copy of h where field is set to value.
+func (h header) with(field, value string) header {
+	c := make(header, len(h)+1)
+	for k, v := range h {
+		c[k] = v
+	}
+	c[field] = []string{value}
+	return c
+}
+
+// An entityWrapper transforms the MIME entity holding the content of a
+// message, e.g. to sign or encrypt it. It writes the new entity to w.
+type entityWrapper func(m *Message, w io.Writer, entity []byte) error
+
 type part struct {
 	contentType string
 	copier      func(io.Writer) error
 	encoding    Encoding
+	// charset overrides the charset of the message when it is not empty.
+	charset string
+	// textAlternative is true if a plain text version of the part must be
+	// derived when the message has no text/plain part.
+	textAlternative bool
 }
 
 // NewMessage creates a new message. It uses UTF-8 and quoted-printable encoding
@@ -35,6 +77,7 @@ func NewMessage(settings ...MessageSetting) *Message {
 		header:   make(header),
 		charset:  "UTF-8",
 		encoding: QuotedPrintable,
+		idToken:  newIDToken(),
 	}
 
 	m.applySettings(settings)
@@ -57,6 +100,12 @@ func (m *Message) Reset() {
 	m.parts = nil
 	m.attachments = nil
 	m.embedded = nil
+	m.envelopeFrom = ""
+	m.envelopeTo = nil
+	m.dsn = nil
+	m.rcptDSN = nil
+	m.repeatedFields = nil
+	m.idToken = newIDToken()
 }
 
 func (m *Message) applySettings(settings []MessageSetting) {
@@ -83,6 +132,43 @@ func SetEncoding(enc Encoding) MessageSetting {
 	}
 }
 
+// SetBoundaryFunc is a message setting to generate the multipart boundaries of
+// the email with f instead of random boundaries. It is mostly useful to get a
+// reproducible output in tests, along with SetHeaderOrder.
+//
+// The boundaries must be valid as defined in RFC 2046 and must not appear in
+// the content of the email.
+func SetBoundaryFunc(f func() string) MessageSetting {
+	return func(m *Message) {
+		m.boundary = f
+	}
+}
+
+// SetHeaderOrder is a message setting to write the given header fields first
+// and in this order. The other fields are sorted alphabetically.
+//
+// DefaultHeaderOrder can be used to get the conventional order.
+func SetHeaderOrder(fields ...string) MessageSetting {
+	return func(m *Message) {
+		m.headerOrder = fields
+	}
+}
+
+// DefaultHeaderOrder is the conventional order of the header fields of an
+// email.
+var DefaultHeaderOrder = []string{
+	"Date", "From", "Sender", "Reply-To", "To", "Cc", "Subject", "Message-ID",
+	"In-Reply-To", "References", "Content-Type", "Content-Transfer-Encoding",
+}
+
+// SetMessageIDDomain is a message setting to set the domain of the generated
+// Message-ID. By default, the domain of the From address is used.
+func SetMessageIDDomain(domain string) MessageSetting {
+	return func(m *Message) {
+		m.idDomain = domain
+	}
+}
+
 // Encoding represents a MIME encoding scheme like quoted-printable or base64.
 type Encoding string
 
@@ -93,16 +179,57 @@ const (
 	// Base64 represents the base64 encoding as defined in RFC 2045.
 	Base64 Encoding = "base64"
 	// Unencoded can be used to avoid encoding the body of an email. The headers
-	// will still be encoded using quoted-printable encoding.
+	// will still be encoded using quoted-printable encoding. When the SMTP
+	// server does not support the 8BITMIME extension, the parts are encoded
+	// using quoted-printable encoding instead.
 	Unencoded Encoding = "8bit"
+	// Binary can be used to send content as is, even with long lines or
+	// binary data. It requires the BINARYMIME and CHUNKING extensions: when
+	// the SMTP server does not support them, parts are encoded using
+	// quoted-printable encoding and files using base64 encoding instead.
+	Binary Encoding = "binary"
 )
 
 // SetHeader sets a value to the given header field.
 func (m *Message) SetHeader(field string, value ...string) {
-	m.encodeHeader(value)
+	if addressHeaders[field] {
+		m.encodeAddresses(value)
+	} else {
+		m.encodeHeader(value)
+	}
 	m.header[field] = value
 }
 
+// addressHeaders are the header fields holding a list of addresses.
+var addressHeaders = map[string]bool{
+	"From":     true,
+	"Sender":   true,
+	"Reply-To": true,
+	"To":       true,
+	"Cc":       true,
+	"Bcc":      true,
+}
+
+// encodeAddresses encodes the names of the addresses of an address field. The
+// addresses are kept as is since they cannot be encoded.
+func (m *Message) encodeAddresses(values []string) {
+	for i, v := range values {
+		if isASCII(v) {
+			continue
+		}
+		list, err := mail.ParseAddressList(v)
+		if err != nil {
+			values[i] = m.encodeString(v)
+			continue
+		}
+		addrs := make([]string, len(list))
+		for j, a := range list {
+			addrs[j] = m.FormatAddress(a.Address, a.Name)
+		}
+		values[i] = strings.Join(addrs, ", ")
+	}
+}
+
 func (m *Message) encodeHeader(values []string) {
 	for i := range values {
 		values[i] = m.encodeString(values[i])
@@ -177,11 +304,87 @@ func (m *Message) FormatDate(date time.Time) string {
 	return date.Format(time.RFC1123Z)
 }
 
+// MessageID returns the Message-ID of the message, e.g.
+// "<1403718360.4f1b3c2a9e7d8b6f@example.com>".
+//
+// If the Message-ID field is not set, a unique ID is generated. It is written
+// when the message is written, without modifying the message, and it stays the
+// same if the email is sent again, until Reset is called. So MessageID can also
+// be used after sending the email, e.g. for logging.
+func (m *Message) MessageID() string {
+	if id, ok := m.headerMessageID(); ok {
+		return id
+	}
+
+	domain := m.idDomain
+	if domain == "" {
+		domain = "localhost"
+		if from, ok := m.header["From"]; ok && len(from) > 0 {
+			if addr, err := parseAddress(from[0]); err == nil {
+				if i := strings.LastIndexByte(addr, '@'); i != -1 {
+					domain = toASCIIDomain(addr[i+1:])
+				}
+			}
+		}
+	}
+
+	token := m.idToken
+	if token == "" {
+		token = newIDToken()
+	}
+	return "<" + token + "@" + domain + ">"
+}
+
+// headerMessageID returns the value of the Message-ID field if it is set.
+func (m *Message) headerMessageID() (string, bool) {
+	for k, v := range m.header {
+		if strings.EqualFold(k, "Message-ID") && len(v) > 0 {
+			return v[0], true
+		}
+	}
+	return "", false
+}
+
+// newIDToken returns the unique part of a generated Message-ID.
+func newIDToken() string {
+	return strconv.FormatInt(now().Unix(), 10) + "." + newMessageIDToken()
+}
+
 // GetHeader gets a header field.
 func (m *Message) GetHeader(field string) []string {
 	return m.header[field]
 }
 
+// SetEnvelopeFrom sets the envelope sender of the message, i.e. the address
+// used in the MAIL FROM command and where bounces are sent. By default, the
+// address of the Sender or From field is used.
+//
+// The receiving server records it in the Return-Path field. An empty address
+// restores the default.
+func (m *Message) SetEnvelopeFrom(address string) {
+	m.envelopeFrom = address
+}
+
+// SetEnvelopeTo sets the envelope recipients of the message, i.e. the addresses
+// used in the RCPT TO commands. By default, the addresses of the To, Cc and Bcc
+// fields are used. Calling SetEnvelopeTo without addresses restores the
+// default.
+func (m *Message) SetEnvelopeTo(addresses ...string) {
+	m.envelopeTo = addresses
+}
+
+// VERPAddress returns the variable envelope return path of sender for
+// recipient, e.g. bounces+bob=example.com@example.org for the sender
+// bounces@example.org and the recipient bob@example.com. It can be used with
+// SetEnvelopeFrom to know which recipient a bounce is for.
+func VERPAddress(sender, recipient string) string {
+	local, domain := sender, ""
+	if i := strings.LastIndexByte(sender, '@'); i != -1 {
+		local, domain = sender[:i], sender[i:]
+	}
+	return local + "+" + strings.Replace(recipient, "@", "=", -1) + domain
+}
+
 // SetBody sets the body of the message. It replaces any content previously set
 // by SetBody, AddAlternative or AddAlternativeWriter.
 func (m *Message) SetBody(contentType, body string, settings ...PartSetting) {
@@ -238,10 +441,25 @@ func SetPartEncoding(e Encoding) PartSetting {
 	})
 }
 
+// setPartCharset sets the charset of the part added to the message, e.g. to
+// keep the charset of a part read by ReadMessage. By default, parts use the
+// charset of the message.
+func setPartCharset(charset string) PartSetting {
+	return PartSetting(func(p *part) {
+		p.charset = charset
+	})
+}
+
 type file struct {
 	Name     string
 	Header   map[string][]string
 	CopyFunc func(w io.Writer) error
+	// encoding is the encoding set with SetFileEncoding. If empty, the content
+	// is encoded in base64.
+	encoding Encoding
+	// writeTo, if set, is used instead of CopyFunc to write an attached
+	// message so that it can be sent with the given transport.
+	writeTo func(io.Writer, transport) error
 }
 
 func (f *file) setHeader(field, value string) {
@@ -280,6 +498,17 @@ func Rename(name string) FileSetting {
 func SetCopyFunc(f func(io.Writer) error) FileSetting {
 	return func(fi *file) {
 		fi.CopyFunc = f
+		fi.writeTo = nil
+	}
+}
+
+// SetFileEncoding is a file setting to set the encoding of the file. By
+// default, files are encoded using base64 encoding. With Unencoded, the content
+// of the file is written as is and must not contain lines longer than 998
+// octets.
+func SetFileEncoding(e Encoding) FileSetting {
+	return func(f *file) {
+		f.encoding = e
 	}
 }
 
@@ -320,3 +549,95 @@ func (m *Message) Attach(filename string, settings ...FileSetting) {
 func (m *Message) Embed(filename string, settings ...FileSetting) {
 	m.embedded = m.appendFile(m.embedded, filename, settings)
 }
+
+// AttachReader attaches a file named name whose content is read from r.
+//
+// r is read when the message is written for the first time. Its content is
+// then kept in memory so that the message can be written several times.
+func (m *Message) AttachReader(name string, r io.Reader, settings ...FileSetting) {
+	m.attachments = m.appendFile(m.attachments, name, readerSettings(r, settings))
+}
+
+// EmbedReader embeds an image named name whose content is read from r.
+//
+// r is read when the message is written for the first time. Its content is
+// then kept in memory so that the message can be written several times.
+func (m *Message) EmbedReader(name string, r io.Reader, settings ...FileSetting) {
+	m.embedded = m.appendFile(m.embedded, name, readerSettings(r, settings))
+}
+
+// AttachMessage attaches msg as a message/rfc822 part, e.g. to forward it.
+//
+// As required by RFC 2046, the attached message is not encoded so its parts
+// should not use the Unencoded encoding if the email is sent to servers which
+// do not support 8BITMIME.
+func (m *Message) AttachMessage(msg *Message, settings ...FileSetting) {
+	m.attachments = m.appendFile(m.attachments, "message.eml", messageSettings(func(w io.Writer) error {
+		_, err := msg.WriteTo(w)
+		return err
+	}, append([]FileSetting{func(f *file) {
+		// The attached message is written with the transport of m so that
+		// its parts are encoded as the SMTP server requires.
+		f.writeTo = func(w io.Writer, t transport) error {
+			_, err := msg.writeTo(w, t)
+			return err
+		}
+	}}, settings...)))
+}
+
+// AttachMessageReader attaches the email read from r as a message/rfc822 part,
+// e.g. to forward an .eml file. Its line endings are converted to CRLF.
+//
+// r is read when the message is written for the first time. Its content is
+// then kept in memory so that the message can be written several times.
+//
+// An attached message with 8-bit content cannot be encoded, so sending fails if
+// the SMTP server does not support the 8BITMIME extension.
+func (m *Message) AttachMessageReader(r io.Reader, settings ...FileSetting) {
+	copier := newReaderCopier(r)
+	m.attachments = m.appendFile(m.attachments, "message.eml", messageSettings(func(w io.Writer) error {
+		buf := new(bytes.Buffer)
+		if err := copier(buf); err != nil {
+			return err
+		}
+		_, err := w.Write(toCRLF(buf.Bytes()))
+		return err
+	}, settings))
+}
+
+func messageSettings(f func(io.Writer) error, settings []FileSetting) []FileSetting {
+	return append([]FileSetting{
+		SetHeader(map[string][]string{"Content-Type": {"message/rfc822"}}),
+		SetCopyFunc(f),
+		SetFileEncoding(Unencoded),
+	}, settings...)
+}
+
+func readerSettings(r io.Reader, settings []FileSetting) []FileSetting {
+	return append([]FileSetting{SetCopyFunc(newReaderCopier(r))}, settings...)
+}
+
+// newReaderCopier returns a copy function that reads r the first time it is
+// called and then copies the content read.
+func newReaderCopier(r io.Reader) func(io.Writer) error {
+	var once sync.Once
+	var buf bytes.Buffer
+	var readErr error
+	return func(w io.Writer) error {
+		once.Do(func() {
+			_, readErr = io.Copy(&buf, r)
+		})
+		if readErr != nil {
+			return readErr
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+}
+
+// Stubbed out for tests.
+var newMessageIDToken = func() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
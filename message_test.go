@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -17,6 +18,9 @@ func init() {
 	now = func() time.Time {
 		return time.Date(2014, 06, 25, 17, 46, 0, 0, time.UTC)
 	}
+	newMessageIDToken = func() string {
+		return "test"
+	}
 }
 
 type message struct {
@@ -324,6 +328,199 @@ func TestRename(t *testing.T) {
 	testMessage(t, m, 1, want)
 }
 
+func TestAttachReader(t *testing.T) {
+	m := NewMessage()
+	m.SetHeader("From", "from@example.com")
+	m.SetHeader("To", "to@example.com")
+	m.AttachReader("test.pdf", strings.NewReader("Content of test.pdf"))
+
+	want := &message{
+		from: "from@example.com",
+		to:   []string{"to@example.com"},
+		content: "From: from@example.com\r\n" +
+			"To: to@example.com\r\n" +
+			"Content-Type: application/pdf; name=\"test.pdf\"\r\n" +
+			"Content-Disposition: attachment; filename=\"test.pdf\"\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			base64.StdEncoding.EncodeToString([]byte("Content of test.pdf")),
+	}
+
+	// The content of the reader must be kept when the message is sent again.
+	testMessage(t, m, 0, want)
+	testMessage(t, m, 0, want)
+}
+
+func TestEmbedReader(t *testing.T) {
+	m := NewMessage()
+	m.SetHeader("From", "from@example.com")
+	m.SetHeader("To", "to@example.com")
+	m.EmbedReader("image.jpg", bytes.NewReader([]byte("Content of image.jpg")), Rename("logo.jpg"))
+
+	want := &message{
+		from: "from@example.com",
+		to:   []string{"to@example.com"},
+		content: "From: from@example.com\r\n" +
+			"To: to@example.com\r\n" +
+			"Content-Type: image/jpeg; name=\"logo.jpg\"\r\n" +
+			"Content-Disposition: inline; filename=\"logo.jpg\"\r\n" +
+			"Content-ID: <logo.jpg>\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			base64.StdEncoding.EncodeToString([]byte("Content of image.jpg")),
+	}
+
+	testMessage(t, m, 0, want)
+}
+
+func TestFileEncoding(t *testing.T) {
+	m := NewMessage()
+	m.SetHeader("From", "from@example.com")
+	m.Attach("test.bin", SetCopyFunc(func(w io.Writer) error {
+		_, err := io.WriteString(w, "\x00\xff")
+		return err
+	}), SetFileEncoding(Binary))
+
+	for _, test := range []struct {
+		t       transport
+		enc     string
+		content string
+	}{
+		{transport{}, "binary", "\x00\xff"},
+		{transport{noBinary: true}, "base64", "AP8="},
+		{transport{sevenBit: true, noBinary: true}, "base64", "AP8="},
+	} {
+		buf := new(bytes.Buffer)
+		if _, err := m.writeTo(buf, test.t); err != nil {
+			t.Fatal(err)
+		}
+		got := buf.String()
+		if !strings.Contains(got, "Content-Transfer-Encoding: "+test.enc+"\r\n") ||
+			!strings.HasSuffix(got, "\r\n\r\n"+test.content) {
+			t.Errorf("Invalid file with %+v, got:\n%s\nwant %s content %q", test.t, got, test.enc, test.content)
+		}
+	}
+}
+
+func TestAttachMessage(t *testing.T) {
+	attached := NewMessage()
+	attached.SetHeader("From", "alice@example.com")
+	attached.SetHeader("Subject", "Original")
+	attached.SetBody("text/plain", "Original message")
+
+	m := NewMessage()
+	m.SetHeader("From", "from@example.com")
+	m.SetHeader("To", "to@example.com")
+	m.SetBody("text/plain", "Test")
+	m.AttachMessage(attached)
+
+	want := &message{
+		from: "from@example.com",
+		to:   []string{"to@example.com"},
+		content: "From: from@example.com\r\n" +
+			"To: to@example.com\r\n" +
+			"Content-Type: multipart/mixed;\r\n" +
+			" boundary=_BOUNDARY_1_\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: text/plain; charset=UTF-8\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"Test\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: message/rfc822\r\n" +
+			"Content-Disposition: attachment; filename=\"message.eml\"\r\n" +
+			"Content-Transfer-Encoding: 7bit\r\n" +
+			"\r\n" +
+			"Mime-Version: 1.0\r\n" +
+			"Date: Wed, 25 Jun 2014 17:46:00 +0000\r\n" +
+			"From: alice@example.com\r\n" +
+			"Message-ID: <1403718360.test@example.com>\r\n" +
+			"Subject: Original\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"Content-Type: text/plain; charset=UTF-8\r\n" +
+			"\r\n" +
+			"Original message\r\n" +
+			"--_BOUNDARY_1_--\r\n",
+	}
+
+	testMessage(t, m, 1, want)
+}
+
+func TestAttachMessageReader(t *testing.T) {
+	m := NewMessage()
+	m.SetHeader("From", "from@example.com")
+	m.SetHeader("To", "to@example.com")
+	m.SetBody("text/plain", "Test")
+	m.AttachMessageReader(strings.NewReader("From: alice@example.com\nSubject: Caf\xc3\xa9\n\nCaf\xc3\xa9\n"), Rename("cafe.eml"))
+
+	want := &message{
+		from: "from@example.com",
+		to:   []string{"to@example.com"},
+		content: "From: from@example.com\r\n" +
+			"To: to@example.com\r\n" +
+			"Content-Type: multipart/mixed;\r\n" +
+			" boundary=_BOUNDARY_1_\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: text/plain; charset=UTF-8\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"Test\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: message/rfc822\r\n" +
+			"Content-Disposition: attachment; filename=\"cafe.eml\"\r\n" +
+			"Content-Transfer-Encoding: 8bit\r\n" +
+			"\r\n" +
+			"From: alice@example.com\r\n" +
+			"Subject: Caf\xc3\xa9\r\n" +
+			"\r\n" +
+			"Caf\xc3\xa9\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_1_--\r\n",
+	}
+
+	testMessage(t, m, 1, want)
+	testMessage(t, m, 1, want)
+}
+
+func TestAttachMessageSevenBit(t *testing.T) {
+	attached := NewMessage(SetEncoding(Unencoded))
+	attached.SetHeader("From", "alice@example.com")
+	attached.SetHeader("Subject", "Café")
+	attached.SetBody("text/plain", "Café")
+
+	m := NewMessage()
+	m.SetHeader("From", "from@example.com")
+	m.AttachMessage(attached)
+
+	buf := new(bytes.Buffer)
+	if _, err := m.writeTo(buf, transport{sevenBit: true}); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	if has8bit(buf.Bytes()) {
+		t.Errorf("Message has 8-bit content:\n%s", got)
+	}
+	for _, want := range []string{
+		"Content-Transfer-Encoding: 7bit\r\n" +
+			"Content-Type: message/rfc822\r\n",
+		"Subject: =?UTF-8?q?Caf=C3=A9?=\r\n",
+		"Content-Transfer-Encoding: quoted-printable\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Missing %q in:\n%s", want, got)
+		}
+	}
+
+	m = NewMessage()
+	m.SetHeader("From", "from@example.com")
+	m.AttachMessageReader(strings.NewReader("From: alice@example.com\n\nCaf\xc3\xa9\n"))
+	if _, err := m.writeTo(new(bytes.Buffer), transport{sevenBit: true}); err == nil {
+		t.Error("writeTo() should fail with an 8-bit attached message and a 7-bit transport")
+	}
+}
+
 func TestAttachmentsOnly(t *testing.T) {
 	m := NewMessage()
 	m.SetHeader("From", "from@example.com")
@@ -511,6 +708,130 @@ func TestFullMessage(t *testing.T) {
 	testMessage(t, m, 0, want)
 }
 
+func TestDeterministicOutput(t *testing.T) {
+	newMessage := func() *Message {
+		var n int
+		m := NewMessage(
+			SetBoundaryFunc(func() string {
+				n++
+				return "boundary" + strconv.Itoa(n)
+			}),
+			SetHeaderOrder(DefaultHeaderOrder...),
+		)
+		m.SetHeader("X-Mailer", "gomail")
+		m.SetHeader("Subject", "Test")
+		m.SetHeader("To", "to@example.com")
+		m.SetHeader("From", "from@example.com")
+		m.SetBody("text/plain", "Test")
+		m.AddAlternative("text/html", "<p>Test</p>")
+		return m
+	}
+
+	want := "Mime-Version: 1.0\r\n" +
+		"Date: Wed, 25 Jun 2014 17:46:00 +0000\r\n" +
+		"From: from@example.com\r\n" +
+		"To: to@example.com\r\n" +
+		"Subject: Test\r\n" +
+		"Message-ID: <1403718360.test@example.com>\r\n" +
+		"X-Mailer: gomail\r\n" +
+		"Content-Type: multipart/alternative;\r\n" +
+		" boundary=boundary1\r\n" +
+		"\r\n" +
+		"--boundary1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		"Test\r\n" +
+		"--boundary1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"Content-Type: text/html; charset=UTF-8\r\n" +
+		"\r\n" +
+		"<p>Test</p>\r\n" +
+		"--boundary1--\r\n"
+
+	for i := 0; i < 5; i++ {
+		buf := new(bytes.Buffer)
+		if _, err := newMessage().WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != want {
+			t.Fatalf("Invalid message, got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
+
+func TestInvalidBoundary(t *testing.T) {
+	m := NewMessage(SetBoundaryFunc(func() string { return "" }))
+	m.SetBody("text/plain", "Test")
+	m.AddAlternative("text/html", "<p>Test</p>")
+	if _, err := m.WriteTo(new(bytes.Buffer)); err == nil {
+		t.Error("WriteTo() should fail with an invalid boundary")
+	}
+}
+
+func TestMessageID(t *testing.T) {
+	m := NewMessage()
+	m.SetAddressHeader("From", "from@example.com", "From")
+	if got, want := m.MessageID(), "<1403718360.test@example.com>"; got != want {
+		t.Errorf("Invalid Message-ID, got %q, want %q", got, want)
+	}
+
+	m.Reset()
+	m.SetHeader("Message-Id", "<custom@example.org>")
+	if got, want := m.MessageID(), "<custom@example.org>"; got != want {
+		t.Errorf("Invalid Message-ID, got %q, want %q", got, want)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(strings.ToLower(buf.String()), "message-id:"); n != 1 {
+		t.Errorf("Invalid number of Message-ID fields, got %d, want 1", n)
+	}
+
+	m = NewMessage(SetMessageIDDomain("mail.example.net"))
+	m.SetHeader("From", "from@example.com")
+	if got, want := m.MessageID(), "<1403718360.test@mail.example.net>"; got != want {
+		t.Errorf("Invalid Message-ID, got %q, want %q", got, want)
+	}
+
+	m = NewMessage()
+	if got, want := m.MessageID(), "<1403718360.test@localhost>"; got != want {
+		t.Errorf("Invalid Message-ID, got %q, want %q", got, want)
+	}
+}
+
+func TestMessageIDWriteTo(t *testing.T) {
+	m := NewMessage()
+	m.SetHeader("From", "from@example.com")
+
+	// Writing the message concurrently is safe since it does not modify it.
+	var wg sync.WaitGroup
+	outputs := make([]string, 2)
+	for i := range outputs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buf := new(bytes.Buffer)
+			if _, err := m.WriteTo(buf); err != nil {
+				t.Error(err)
+			}
+			outputs[i] = buf.String()
+		}(i)
+	}
+	wg.Wait()
+
+	if len(m.GetHeader("Message-ID")) != 0 {
+		t.Error("WriteTo should not set the Message-ID field")
+	}
+	want := "Message-ID: " + m.MessageID() + "\r\n"
+	for _, got := range outputs {
+		if !strings.Contains(got, want) {
+			t.Errorf("Missing %q in:\n%s", want, got)
+		}
+	}
+}
+
 func TestQpLineLength(t *testing.T) {
 	m := NewMessage()
 	m.SetHeader("From", "from@example.com")
@@ -628,6 +949,10 @@ func stubSendMail(t *testing.T, bCount int, want *message) SendFunc {
 		wantMsg := string("Mime-Version: 1.0\r\n" +
 			"Date: Wed, 25 Jun 2014 17:46:00 +0000\r\n" +
 			want.content)
+		if header, _ := splitMessage([]byte(want.content)); !bytes.Contains(header, []byte("Message-ID: ")) {
+			domain := want.from[strings.LastIndexByte(want.from, '@')+1:]
+			wantMsg = strings.Replace(wantMsg, "\r\n", "\r\nMessage-ID: <1403718360.test@"+domain+">\r\n", 1)
+		}
 		if bCount > 0 {
 			boundaries := getBoundaries(t, bCount, got)
 			for i, b := range boundaries {
@@ -0,0 +1,103 @@
+package gomail
+
+import (
+	"bytes"
+	"io"
+)
+
+// A PGPSigner creates OpenPGP detached signatures. It can be implemented with
+// any OpenPGP library, e.g. golang.org/x/crypto/openpgp.
+type PGPSigner interface {
+	// Micalg returns the hash algorithm used by the signer as defined in
+	// RFC 3156, section 5, e.g. "pgp-sha256".
+	Micalg() string
+	// DetachSign writes to w the ASCII-armored detached signature of the data
+	// read from r.
+	DetachSign(w io.Writer, r io.Reader) error
+}
+
+// A PGPEncrypter encrypts data with OpenPGP. It can be implemented with any
+// OpenPGP library, e.g. golang.org/x/crypto/openpgp.
+type PGPEncrypter interface {
+	// Encrypt writes to w the ASCII-armored OpenPGP message holding the
+	// encrypted data read from r.
+	Encrypt(w io.Writer, r io.Reader) error
+}
+
+// SetPGPSigner is a message setting to sign the email with OpenPGP as defined
+// in RFC 3156. The content of the email is sent in a multipart/signed entity
+// along with an application/pgp-signature detached signature.
+//
+// Since signed content must not be modified in transit, the parts of the email
+// should not use the Unencoded encoding.
+//
+// When used with SetPGPEncrypter, the settings are applied in the given order:
+// the email is signed then encrypted if SetPGPSigner comes first.
+func SetPGPSigner(s PGPSigner) MessageSetting {
+	return func(m *Message) {
+		m.wrappers = append(m.wrappers, func(m *Message, w io.Writer, entity []byte) error {
+			return writePGPSigned(m, w, entity, s)
+		})
+	}
+}
+
+// SetPGPEncrypter is a message setting to encrypt the email with OpenPGP as
+// defined in RFC 3156. The content of the email is sent in a
+// multipart/encrypted entity.
+func SetPGPEncrypter(e PGPEncrypter) MessageSetting {
+	return func(m *Message) {
+		m.wrappers = append(m.wrappers, func(m *Message, w io.Writer, entity []byte) error {
+			return writePGPEncrypted(m, w, entity, e)
+		})
+	}
+}
+
+func writePGPSigned(m *Message, w io.Writer, entity []byte, s PGPSigner) error {
+	sig := new(bytes.Buffer)
+	if err := s.DetachSign(sig, bytes.NewReader(entity)); err != nil {
+		return err
+	}
+
+	boundary := m.newBoundary()
+	mw := &messageWriter{w: w}
+	mw.writeString("Content-Type: multipart/signed;\r\n" +
+		" protocol=\"application/pgp-signature\"; micalg=" + s.Micalg() + ";\r\n" +
+		" boundary=" + boundary + "\r\n\r\n")
+	mw.writeString("--" + boundary + "\r\n")
+	mw.Write(entity)
+	mw.writeString("\r\n--" + boundary + "\r\n")
+	mw.writeString("Content-Type: application/pgp-signature; name=\"signature.asc\"\r\n" +
+		"Content-Disposition: attachment; filename=\"signature.asc\"\r\n\r\n")
+	mw.Write(toCRLF(sig.Bytes()))
+	mw.writeString("\r\n--" + boundary + "--\r\n")
+	return mw.err
+}
+
+func writePGPEncrypted(m *Message, w io.Writer, entity []byte, e PGPEncrypter) error {
+	encrypted := new(bytes.Buffer)
+	if err := e.Encrypt(encrypted, bytes.NewReader(entity)); err != nil {
+		return err
+	}
+
+	boundary := m.newBoundary()
+	mw := &messageWriter{w: w}
+	mw.writeString("Content-Type: multipart/encrypted;\r\n" +
+		" protocol=\"application/pgp-encrypted\";\r\n" +
+		" boundary=" + boundary + "\r\n\r\n")
+	mw.writeString("--" + boundary + "\r\n")
+	mw.writeString("Content-Type: application/pgp-encrypted\r\n\r\n" +
+		"Version: 1\r\n")
+	mw.writeString("\r\n--" + boundary + "\r\n")
+	mw.writeString("Content-Type: application/octet-stream; name=\"encrypted.asc\"\r\n" +
+		"Content-Disposition: inline; filename=\"encrypted.asc\"\r\n\r\n")
+	mw.Write(toCRLF(encrypted.Bytes()))
+	mw.writeString("\r\n--" + boundary + "--\r\n")
+	return mw.err
+}
+
+// toCRLF converts the line endings of ASCII-armored data to CRLF, since OpenPGP
+// libraries usually use LF.
+func toCRLF(b []byte) []byte {
+	b = bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
+	return bytes.Replace(b, []byte("\n"), []byte("\r\n"), -1)
+}
@@ -0,0 +1,210 @@
+package gomail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+)
+
+// testPGPSigner "signs" data with its SHA-256 hash.
+type testPGPSigner struct{}
+
+func (testPGPSigner) Micalg() string { return "pgp-sha256" }
+
+func (testPGPSigner) DetachSign(w io.Writer, r io.Reader) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "-----BEGIN PGP SIGNATURE-----\n\n"+
+		hex.EncodeToString(h.Sum(nil))+"\n-----END PGP SIGNATURE-----\n")
+	return err
+}
+
+// testPGPEncrypter "encrypts" data by encoding it in base64.
+type testPGPEncrypter struct{}
+
+func (testPGPEncrypter) Encrypt(w io.Writer, r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "-----BEGIN PGP MESSAGE-----\n\n"+
+		base64.StdEncoding.EncodeToString(b)+"\n-----END PGP MESSAGE-----\n")
+	return err
+}
+
+func TestPGPSign(t *testing.T) {
+	m := NewMessage(SetPGPSigner(testPGPSigner{}))
+	m.SetHeader("From", "from@example.com")
+	m.SetBody("text/plain", "Test")
+	m.AddAlternative("text/html", "<p>Test</p>")
+
+	header, body := splitWrittenMessage(t, m)
+	mediaType, params, err := mime.ParseMediaType(headerValue(header, "Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/signed" ||
+		params["protocol"] != "application/pgp-signature" ||
+		params["micalg"] != "pgp-sha256" {
+		t.Fatalf("Invalid Content-Type: %s %v", mediaType, params)
+	}
+
+	entity, sig := splitPGPSigned(t, body, params["boundary"])
+	if !strings.HasPrefix(entity, "Content-Type: multipart/alternative;") {
+		t.Errorf("Invalid signed entity: %q", entity)
+	}
+	verifyPGPSignature(t, entity, sig)
+}
+
+func TestPGPEncrypt(t *testing.T) {
+	m := NewMessage(SetPGPEncrypter(testPGPEncrypter{}))
+	m.SetHeader("From", "from@example.com")
+	m.SetBody("text/plain", "Test")
+
+	header, body := splitWrittenMessage(t, m)
+	entity := decryptPGP(t, header, body)
+
+	h, content := splitMessage(entity)
+	if ct := headerValue(string(h), "Content-Type"); ct != "text/plain; charset=UTF-8" {
+		t.Errorf("Invalid Content-Type, got %q", ct)
+	}
+	if string(content) != "Test" {
+		t.Errorf("Invalid decrypted content, got %q, want %q", content, "Test")
+	}
+}
+
+func TestPGPSignAndEncrypt(t *testing.T) {
+	m := NewMessage(SetPGPSigner(testPGPSigner{}), SetPGPEncrypter(testPGPEncrypter{}))
+	m.SetHeader("From", "from@example.com")
+	m.SetBody("text/plain", "Test")
+	m.AddAlternative("text/html", `<img src="cid:image.jpg">`)
+	m.Embed("image.jpg", SetCopyFunc(func(w io.Writer) error {
+		_, err := w.Write([]byte("Image"))
+		return err
+	}))
+	m.Attach("file.txt", SetCopyFunc(func(w io.Writer) error {
+		_, err := w.Write([]byte("Content"))
+		return err
+	}))
+
+	header, body := splitWrittenMessage(t, m)
+	entity := decryptPGP(t, header, body)
+
+	h, content := splitMessage(entity)
+	_, params, err := mime.ParseMediaType(headerValue(string(h), "Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, sig := splitPGPSigned(t, string(content), params["boundary"])
+	verifyPGPSignature(t, signed, sig)
+
+	h, content = splitMessage([]byte(signed))
+	mediaType, params, err := mime.ParseMediaType(headerValue(string(h), "Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("Invalid signed entity type: %s", mediaType)
+	}
+	var types []string
+	r := multipart.NewReader(bytes.NewReader(content), params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		mediaType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		types = append(types, mediaType)
+	}
+	if got, want := strings.Join(types, ","), "multipart/related,text/plain"; got != want {
+		t.Errorf("Invalid parts, got %s, want %s", got, want)
+	}
+}
+
+type errPGPSigner struct{ testPGPSigner }
+
+func (errPGPSigner) DetachSign(io.Writer, io.Reader) error {
+	return errors.New("gomail: test error")
+}
+
+func TestPGPSignError(t *testing.T) {
+	m := NewMessage(SetPGPSigner(errPGPSigner{}))
+	m.SetBody("text/plain", "Test")
+	if _, err := m.WriteTo(new(bytes.Buffer)); err == nil {
+		t.Error("WriteTo() should fail when the signer fails")
+	}
+}
+
+// splitPGPSigned returns the signed entity and the signature of a
+// multipart/signed body.
+func splitPGPSigned(t *testing.T, body, boundary string) (string, string) {
+	parts := strings.Split(body, "\r\n--"+boundary)
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "--"+boundary+"\r\n") ||
+		!strings.HasPrefix(parts[2], "--\r\n") {
+		t.Fatalf("Invalid multipart/signed body: %q", body)
+	}
+	entity := strings.TrimPrefix(parts[0], "--"+boundary+"\r\n")
+
+	header, sig := splitMessage([]byte(parts[1]))
+	if ct := headerValue(string(header), "Content-Type"); !strings.HasPrefix(ct, "application/pgp-signature") {
+		t.Fatalf("Invalid signature Content-Type: %q", ct)
+	}
+	return entity, string(sig)
+}
+
+func verifyPGPSignature(t *testing.T, entity, sig string) {
+	h := sha256.Sum256([]byte(entity))
+	want := "-----BEGIN PGP SIGNATURE-----\r\n\r\n" + hex.EncodeToString(h[:]) +
+		"\r\n-----END PGP SIGNATURE-----\r\n"
+	if sig != want {
+		t.Errorf("Invalid signature, got %q, want %q", sig, want)
+	}
+}
+
+func decryptPGP(t *testing.T, header, body string) []byte {
+	mediaType, params, err := mime.ParseMediaType(headerValue(header, "Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/encrypted" || params["protocol"] != "application/pgp-encrypted" {
+		t.Fatalf("Invalid Content-Type: %s %v", mediaType, params)
+	}
+
+	r := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	p, err := r.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	control, err := ioutil.ReadAll(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := p.Header.Get("Content-Type"); ct != "application/pgp-encrypted" || string(control) != "Version: 1\r\n" {
+		t.Errorf("Invalid control part: %s %q", ct, control)
+	}
+
+	p, err = r.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	armored, err := ioutil.ReadAll(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := strings.TrimPrefix(string(armored), "-----BEGIN PGP MESSAGE-----\r\n\r\n")
+	s = strings.TrimSuffix(s, "\r\n-----END PGP MESSAGE-----\r\n")
+	return decodeBase64(t, s)
+}
@@ -0,0 +1,224 @@
+package gomail
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// A Pool is a Sender that keeps a pool of connections to an SMTP server. It is
+// safe for concurrent use by multiple goroutines.
+//
+// The fields of a Pool must not be modified after it is first used.
+type Pool struct {
+	// MaxOpen is the maximum number of open connections to the SMTP server.
+	// When the limit is reached, senders wait for a connection to be
+	// available. By default, there is no limit.
+	MaxOpen int
+	// MaxIdle is the maximum number of idle connections kept in the pool. By
+	// default, 2 idle connections are kept.
+	MaxIdle int
+	// IdleTimeout is the maximum amount of time a connection may be idle
+	// before being closed. By default, idle connections are not closed.
+	IdleTimeout time.Duration
+	// MaxMessages is the maximum number of emails sent using the same
+	// connection. By default, there is no limit.
+	MaxMessages int
+
+	d      *Dialer
+	mu     sync.Mutex
+	idle   []*poolConn
+	sem    chan struct{}
+	closed bool
+}
+
+// poolConn is a connection managed by a Pool.
+type poolConn struct {
+	s         *smtpSender
+	sent      int
+	idleSince time.Time
+}
+
+// NewPool returns a new Pool that uses the given Dialer to connect to the SMTP
+// server. The Pool should be closed when done using it.
+func NewPool(d *Dialer) *Pool {
+	return &Pool{d: d}
+}
+
+const defaultMaxIdle = 2
+
+var errPoolClosed = errors.New("gomail: pool is closed")
+
+// Send sends an email using one of the connections of the pool.
+func (p *Pool) Send(from string, to []string, msg io.WriterTo) error {
+	return p.SendContext(context.Background(), from, to, msg)
+}
+
+// SendContext sends an email using one of the connections of the pool. The
+// context is used both while waiting for a connection and while sending.
+func (p *Pool) SendContext(ctx context.Context, from string, to []string, msg io.WriterTo) error {
+	_, err := p.Deliver(ctx, from, to, msg)
+	return err
+}
+
+// Deliver sends an email using one of the connections of the pool and reports
+// which recipients were accepted by the SMTP server.
+func (p *Pool) Deliver(ctx context.Context, from string, to []string, msg io.WriterTo) (*Delivery, error) {
+	c, err := p.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := c.s.Deliver(ctx, from, to, msg)
+	p.put(ctx, c, err)
+	return delivery, err
+}
+
+// Close closes all the idle connections of the pool. The connections in use
+// are closed as soon as they are released.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.mu.Unlock()
+
+	var err error
+	for _, c := range idle {
+		if cerr := c.s.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// get returns an idle connection that is still alive or opens a new one.
+func (p *Pool) get(ctx context.Context) (*poolConn, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errPoolClosed
+	}
+	if p.sem == nil && p.MaxOpen > 0 {
+		p.sem = make(chan struct{}, p.MaxOpen)
+	}
+	sem := p.sem
+	p.mu.Unlock()
+
+	if sem != nil {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	for {
+		c := p.popIdle()
+		if c == nil {
+			break
+		}
+		if p.expired(c) {
+			c.s.Close()
+			continue
+		}
+		// Make sure the SMTP server did not close the connection in the
+		// meantime.
+		if err := c.s.do(ctx, "NOOP", p.d.CommandTimeout, c.s.Noop); err != nil {
+			c.s.smtpClient.Close()
+			if ctx.Err() != nil {
+				p.release()
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		return c, nil
+	}
+
+	sc, err := p.d.DialContext(ctx)
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+	return &poolConn{s: sc.(*smtpSender)}, nil
+}
+
+func (p *Pool) popIdle() *poolConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := len(p.idle)
+	if n == 0 {
+		return nil
+	}
+	c := p.idle[n-1]
+	p.idle[n-1] = nil
+	p.idle = p.idle[:n-1]
+	return c
+}
+
+func (p *Pool) expired(c *poolConn) bool {
+	return p.IdleTimeout > 0 && now().Sub(c.idleSince) > p.IdleTimeout
+}
+
+// put gives back to the pool a connection that was used to send an email. err
+// is the error returned when sending the email.
+func (p *Pool) put(ctx context.Context, c *poolConn, err error) {
+	defer p.release()
+
+	if err != nil {
+		if !isProtocolError(err) {
+			// The connection is in an unknown state.
+			c.s.smtpClient.Close()
+			return
+		}
+		// The SMTP server rejected a command: reset the transaction so that
+		// the connection can be reused.
+		if err := c.s.reset(ctx); err != nil {
+			c.s.smtpClient.Close()
+			return
+		}
+	}
+
+	c.sent++
+	if p.MaxMessages > 0 && c.sent >= p.MaxMessages {
+		c.s.Close()
+		return
+	}
+
+	maxIdle := p.MaxIdle
+	if maxIdle == 0 {
+		maxIdle = defaultMaxIdle
+	}
+
+	c.idleSince = now()
+	var closing []*poolConn
+	p.mu.Lock()
+	if p.closed || len(p.idle) >= maxIdle {
+		closing = append(closing, c)
+	} else {
+		p.idle = append(p.idle, c)
+	}
+	// Remove the connections that have been idle for too long. They are
+	// ordered from the oldest to the most recently used.
+	n := 0
+	for n < len(p.idle) && p.expired(p.idle[n]) {
+		n++
+	}
+	closing = append(closing, p.idle[:n]...)
+	p.idle = append(p.idle[:0], p.idle[n:]...)
+	p.mu.Unlock()
+
+	for _, c := range closing {
+		c.s.Close()
+	}
+}
+
+// release frees a slot for a new connection.
+func (p *Pool) release() {
+	if p.sem != nil {
+		<-p.sem
+	}
+}
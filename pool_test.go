@@ -0,0 +1,244 @@
+package gomail
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoolReuse(t *testing.T) {
+	stats := stubPoolDial(t)
+	p := NewPool(&Dialer{Host: testHost, Port: testPort})
+	defer p.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := Send(p, getTestMessage()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats.assert(t, "dials", stats.dials, 1)
+	stats.assert(t, "NOOP", stats.noops, 2)
+	stats.assert(t, "messages", stats.messages, 3)
+}
+
+func TestPoolMaxMessages(t *testing.T) {
+	stats := stubPoolDial(t)
+	p := NewPool(&Dialer{Host: testHost, Port: testPort})
+	p.MaxMessages = 2
+	defer p.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := Send(p, getTestMessage()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats.assert(t, "dials", stats.dials, 2)
+	stats.assert(t, "QUIT", stats.quits, 1)
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	stats := stubPoolDial(t)
+	p := NewPool(&Dialer{Host: testHost, Port: testPort})
+	p.IdleTimeout = time.Minute
+	defer p.Close()
+
+	current := now()
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return current }
+
+	if err := Send(p, getTestMessage()); err != nil {
+		t.Fatal(err)
+	}
+	current = current.Add(2 * time.Minute)
+	if err := Send(p, getTestMessage()); err != nil {
+		t.Fatal(err)
+	}
+
+	stats.assert(t, "dials", stats.dials, 2)
+	stats.assert(t, "NOOP", stats.noops, 0)
+	stats.assert(t, "QUIT", stats.quits, 1)
+}
+
+func TestPoolRejectedRecipient(t *testing.T) {
+	stats := stubPoolDial(t)
+	stats.rcptErr = &textproto.Error{Code: 550, Msg: "No such user"}
+	p := NewPool(&Dialer{Host: testHost, Port: testPort})
+	defer p.Close()
+
+	if err := Send(p, getTestMessage()); err == nil {
+		t.Fatal("Send() should fail when a recipient is rejected")
+	}
+	stats.rcptErr = nil
+	if err := Send(p, getTestMessage()); err != nil {
+		t.Fatal(err)
+	}
+
+	stats.assert(t, "dials", stats.dials, 1)
+	stats.assert(t, "RSET", stats.resets, 1)
+}
+
+func TestPoolConcurrent(t *testing.T) {
+	stats := stubPoolDial(t)
+	stats.delay = 5 * time.Millisecond
+	p := NewPool(&Dialer{Host: testHost, Port: testPort})
+	p.MaxOpen = 2
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := Send(p, getTestMessage()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats.assert(t, "messages", stats.messages, 10)
+	if stats.maxOpen > 2 {
+		t.Errorf("Too many open connections, got %d, want at most 2", stats.maxOpen)
+	}
+}
+
+func TestPoolMaxOpenContext(t *testing.T) {
+	stubPoolDial(t)
+	p := NewPool(&Dialer{Host: testHost, Port: testPort})
+	p.MaxOpen = 1
+	defer p.Close()
+
+	c, err := p.get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.put(context.Background(), c, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := SendContext(ctx, p, getTestMessage()); err == nil {
+		t.Error("SendContext() should fail when no connection is available")
+	}
+}
+
+func TestPoolClosed(t *testing.T) {
+	stubPoolDial(t)
+	p := NewPool(&Dialer{Host: testHost, Port: testPort})
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Send(p, getTestMessage()); err == nil {
+		t.Error("Send() should fail when the pool is closed")
+	}
+}
+
+type poolStats struct {
+	mu       sync.Mutex
+	dials    int
+	noops    int
+	resets   int
+	quits    int
+	messages int
+	open     int
+	maxOpen  int
+	delay    time.Duration
+	rcptErr  error
+}
+
+func (s *poolStats) assert(t *testing.T, name string, got, want int) {
+	if got != want {
+		t.Errorf("Invalid number of %s, got %d, want %d", name, got, want)
+	}
+}
+
+func stubPoolDial(t *testing.T) *poolStats {
+	stats := new(poolStats)
+	netDialContext = func(ctx context.Context, network, address string, d time.Duration) (net.Conn, error) {
+		return testConn, nil
+	}
+	smtpNewClient = func(conn net.Conn, host string) (smtpClient, error) {
+		stats.mu.Lock()
+		defer stats.mu.Unlock()
+		stats.dials++
+		stats.open++
+		if stats.open > stats.maxOpen {
+			stats.maxOpen = stats.open
+		}
+		return &poolClient{stats: stats}, nil
+	}
+	return stats
+}
+
+// poolClient is an smtpClient that can be used concurrently.
+type poolClient struct {
+	stats *poolStats
+}
+
+func (c *poolClient) Hello(string) error              { return nil }
+func (c *poolClient) Extension(string) (bool, string) { return false, "" }
+func (c *poolClient) StartTLS(*tls.Config) error      { return nil }
+func (c *poolClient) Auth(smtp.Auth) error            { return nil }
+func (c *poolClient) Mail(string, ...string) error    { return nil }
+
+func (c *poolClient) TLSConnectionState() (tls.ConnectionState, bool) {
+	return tls.ConnectionState{}, false
+}
+
+func (c *poolClient) Rcpt(string, ...string) error {
+	return c.stats.rcptErr
+}
+
+func (c *poolClient) Data() (io.WriteCloser, error) {
+	time.Sleep(c.stats.delay)
+	c.stats.mu.Lock()
+	c.stats.messages++
+	c.stats.mu.Unlock()
+	return nopWriteCloser{ioutil.Discard}, nil
+}
+
+func (c *poolClient) Bdat([]byte, bool) error {
+	return nil
+}
+
+func (c *poolClient) Noop() error {
+	c.stats.mu.Lock()
+	c.stats.noops++
+	c.stats.mu.Unlock()
+	return nil
+}
+
+func (c *poolClient) Reset() error {
+	c.stats.mu.Lock()
+	c.stats.resets++
+	c.stats.mu.Unlock()
+	return nil
+}
+
+func (c *poolClient) Quit() error {
+	c.stats.mu.Lock()
+	c.stats.quits++
+	c.stats.mu.Unlock()
+	return c.Close()
+}
+
+func (c *poolClient) Close() error {
+	c.stats.mu.Lock()
+	c.stats.open--
+	c.stats.mu.Unlock()
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,209 @@
+package gomail
+
+import (
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// ReadMessage reads an RFC 5322 email, e.g. an .eml file, and returns the
+// corresponding Message so that it can be modified and sent.
+//
+// Header fields are decoded and encoded again when the message is written.
+// Fields appearing several times, such as Received, are written as many times
+// as they were read. The MIME tree of the email is flattened: text parts become
+// the body and its alternatives, inline parts of a multipart/related entity
+// become embedded files and other parts become attachments.
+func ReadMessage(r io.Reader) (*Message, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m := NewMessage()
+	m.readHeader(msg.Header)
+
+	h := textproto.MIMEHeader(msg.Header)
+	if err := m.readEntity(h, msg.Body, nil); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// readHeader sets the header fields of the message, except the MIME fields
+// which are generated when the message is written.
+func (m *Message) readHeader(h mail.Header) {
+	dec := new(mime.WordDecoder)
+	for field, values := range h {
+		switch field {
+		case "Mime-Version", "Content-Type", "Content-Transfer-Encoding":
+			continue
+		}
+
+		if len(values) > 1 {
+			// The field must be written as many times as it was read, e.g.
+			// the Received fields.
+			if m.repeatedFields == nil {
+				m.repeatedFields = make(map[string]bool)
+			}
+			m.repeatedFields[fieldName(field)] = true
+		} else if addressHeaders[field] {
+			if list, err := h.AddressList(field); err == nil {
+				addrs := make([]string, len(list))
+				for i, a := range list {
+					addrs[i] = m.FormatAddress(a.Address, a.Name)
+				}
+				m.header[field] = addrs
+				continue
+			}
+		}
+
+		decoded := make([]string, len(values))
+		for i, v := range values {
+			d, err := dec.DecodeHeader(v)
+			if err != nil {
+				// Keep the encoded value if the charset is unknown.
+				d = v
+			}
+			decoded[i] = d
+		}
+		m.SetHeader(fieldName(field), decoded...)
+	}
+}
+
+// fieldName returns the spelling of a header field name used by gomail, since
+// net/textproto canonicalizes "Message-ID" as "Message-Id".
+func fieldName(field string) string {
+	switch field {
+	case "Message-Id":
+		return "Message-ID"
+	case "Content-Id":
+		return "Content-ID"
+	}
+	return field
+}
+
+// readEntity adds the content of a MIME entity to the message. ancestors are
+// the media types of the enclosing multipart entities, the outermost first.
+func (m *Message) readEntity(h textproto.MIMEHeader, body io.Reader, ancestors []string) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{"charset": "us-ascii"}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		ancestors = append(ancestors[:len(ancestors):len(ancestors)], mediaType)
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := m.readEntity(p.Header, p, ancestors); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := ioutil.ReadAll(decodeBody(body, h.Get("Content-Transfer-Encoding")))
+	if err != nil {
+		return err
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	name := dispParams["filename"]
+	if name == "" {
+		name = params["name"]
+	}
+	if name != "" {
+		if d, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+			name = d
+		}
+	}
+
+	// A text part is a body part if it is an alternative, even when it is
+	// related to other parts, e.g. an HTML part and its images.
+	var parent string
+	inAlternative := false
+	for _, t := range ancestors {
+		parent = t
+		if t == "multipart/alternative" {
+			inAlternative = true
+		}
+	}
+	isText := mediaType == "text/plain" || mediaType == "text/html"
+	switch {
+	case isText && name == "" && disposition != "attachment" &&
+		(inAlternative || len(m.parts) == 0):
+		m.readPart(mediaType, params["charset"], h.Get("Content-Transfer-Encoding"), content)
+	case parent == "multipart/related" && disposition != "attachment":
+		m.embedded = m.appendFile(m.embedded, name, readFileSettings(name, h, content))
+	case mediaType == "message/rfc822":
+		m.attachments = m.appendFile(m.attachments, name, append(readFileSettings(name, h, content), SetFileEncoding(Unencoded)))
+	default:
+		m.attachments = m.appendFile(m.attachments, name, readFileSettings(name, h, content))
+	}
+	return nil
+}
+
+// readPart adds a text part to the message. Its content is kept as is so the
+// part keeps its charset.
+func (m *Message) readPart(mediaType, charset, encoding string, content []byte) {
+	var enc Encoding
+	switch strings.ToLower(encoding) {
+	case "base64":
+		enc = Base64
+	case "8bit", "binary":
+		enc = Unencoded
+	default:
+		enc = QuotedPrintable
+	}
+
+	settings := []PartSetting{SetPartEncoding(enc)}
+	if charset != "" && !strings.EqualFold(charset, "us-ascii") {
+		settings = append(settings, setPartCharset(charset))
+	}
+	m.AddAlternativeWriter(mediaType, newCopier(string(content)), settings...)
+}
+
+// readFileSettings returns the settings of a file holding content. Its MIME
+// header fields are kept, except Content-Transfer-Encoding since files are
+// always encoded in base64.
+func readFileSettings(name string, h textproto.MIMEHeader, content []byte) []FileSetting {
+	header := make(map[string][]string)
+	for k, v := range h {
+		if k != "Content-Transfer-Encoding" {
+			header[fieldName(k)] = v
+		}
+	}
+	return []FileSetting{
+		Rename(name),
+		SetHeader(header),
+		SetCopyFunc(func(w io.Writer) error {
+			_, err := w.Write(content)
+			return err
+		}),
+	}
+}
+
+// decodeBody returns a reader decoding the body of an entity. The
+// quoted-printable encoding is already removed by mime/multipart for the parts
+// of a multipart entity.
+func decodeBody(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(encoding) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
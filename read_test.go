@@ -0,0 +1,323 @@
+package gomail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReadMessageRoundTrip(t *testing.T) {
+	m := NewMessage()
+	m.SetAddressHeader("From", "from@example.com", "Señor From")
+	m.SetHeader("To", "to@example.com")
+	m.SetHeader("Subject", "¡Hola, señor!")
+	m.SetBody("text/plain", "¡Hola, señor!")
+	m.AddAlternative("text/html", "¡<b>Hola</b>, <i>señor</i>!</h1>")
+	m.Attach(mockCopyFile("test.pdf"))
+	m.Embed(mockCopyFile("image.jpg"))
+
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadMessage(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &message{
+		from: "from@example.com",
+		to:   []string{"to@example.com"},
+		content: "From: =?UTF-8?q?Se=C3=B1or_From?= <from@example.com>\r\n" +
+			"To: to@example.com\r\n" +
+			"Subject: =?UTF-8?q?=C2=A1Hola,_se=C3=B1or!?=\r\n" +
+			"Content-Type: multipart/mixed;\r\n" +
+			" boundary=_BOUNDARY_1_\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: multipart/related;\r\n" +
+			" boundary=_BOUNDARY_2_\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_2_\r\n" +
+			"Content-Type: multipart/alternative;\r\n" +
+			" boundary=_BOUNDARY_3_\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_3_\r\n" +
+			"Content-Type: text/plain; charset=UTF-8\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"=C2=A1Hola, se=C3=B1or!\r\n" +
+			"--_BOUNDARY_3_\r\n" +
+			"Content-Type: text/html; charset=UTF-8\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"=C2=A1<b>Hola</b>, <i>se=C3=B1or</i>!</h1>\r\n" +
+			"--_BOUNDARY_3_--\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_2_\r\n" +
+			"Content-Type: image/jpeg; name=\"image.jpg\"\r\n" +
+			"Content-Disposition: inline; filename=\"image.jpg\"\r\n" +
+			"Content-ID: <image.jpg>\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			base64.StdEncoding.EncodeToString([]byte("Content of image.jpg")) + "\r\n" +
+			"--_BOUNDARY_2_--\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: application/pdf; name=\"test.pdf\"\r\n" +
+			"Content-Disposition: attachment; filename=\"test.pdf\"\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			base64.StdEncoding.EncodeToString([]byte("Content of test.pdf")) + "\r\n" +
+			"--_BOUNDARY_1_--\r\n",
+	}
+
+	testMessage(t, m, 3, want)
+}
+
+func TestReadMessage(t *testing.T) {
+	eml := "From: =?ISO-8859-1?Q?Andr=E9?= <andre@example.com>\r\n" +
+		"To: a@example.com, \"B\" <b@example.com>\r\n" +
+		"Subject: =?ISO-8859-1?Q?Caf=E9?=\r\n" +
+		"Date: Wed, 25 Jun 2014 17:46:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+		"\r\n" +
+		"This is a multi-part message in MIME format.\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain; charset=ISO-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Caf=E9\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain; name=\"notes.txt\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"Tm90\r\n" +
+		"ZXM=\r\n" +
+		"--outer--\r\n"
+
+	m, err := ReadMessage(strings.NewReader(eml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &message{
+		from: "andre@example.com",
+		to:   []string{"a@example.com", "b@example.com"},
+		content: "From: =?UTF-8?q?Andr=C3=A9?= <andre@example.com>\r\n" +
+			"To: a@example.com, \"B\" <b@example.com>\r\n" +
+			"Subject: =?UTF-8?q?Caf=C3=A9?=\r\n" +
+			"Content-Type: multipart/mixed;\r\n" +
+			" boundary=_BOUNDARY_1_\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: text/plain; charset=ISO-8859-1\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"Caf=E9\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: text/plain; name=\"notes.txt\"\r\n" +
+			"Content-Disposition: attachment; filename=\"notes.txt\"\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			base64.StdEncoding.EncodeToString([]byte("Notes")) + "\r\n" +
+			"--_BOUNDARY_1_--\r\n",
+	}
+
+	// The Date header field is kept and expected by testMessage.
+	testMessage(t, m, 1, want)
+}
+
+func TestReadMessageCharsets(t *testing.T) {
+	eml := "From: =?ISO-8859-1?Q?Andr=E9?= <andre@example.com>\r\n" +
+		"Subject: =?ISO-8859-1?Q?Caf=E9?=\r\n" +
+		"Content-Type: multipart/alternative; boundary=\"alt\"\r\n" +
+		"\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/plain; charset=ISO-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Caf=E9\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/html; charset=UTF-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"<p>Caf=C3=A9</p>\r\n" +
+		"--alt--\r\n"
+
+	m, err := ReadMessage(strings.NewReader(eml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetHeader("Subject", "¡Café!")
+
+	want := &message{
+		from: "andre@example.com",
+		content: "From: =?UTF-8?q?Andr=C3=A9?= <andre@example.com>\r\n" +
+			"Subject: =?UTF-8?q?=C2=A1Caf=C3=A9!?=\r\n" +
+			"Content-Type: multipart/alternative;\r\n" +
+			" boundary=_BOUNDARY_1_\r\n" +
+			"\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: text/plain; charset=ISO-8859-1\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"Caf=E9\r\n" +
+			"--_BOUNDARY_1_\r\n" +
+			"Content-Type: text/html; charset=UTF-8\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"<p>Caf=C3=A9</p>\r\n" +
+			"--_BOUNDARY_1_--\r\n",
+	}
+
+	testMessage(t, m, 1, want)
+}
+
+func TestReadMessageRelatedAlternative(t *testing.T) {
+	eml := "From: from@example.com\r\n" +
+		"Content-Type: multipart/alternative; boundary=alt\r\n" +
+		"\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Logo\r\n" +
+		"--alt\r\n" +
+		"Content-Type: multipart/related; boundary=rel\r\n" +
+		"\r\n" +
+		"--rel\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<img src=\"cid:logo.png\">\r\n" +
+		"--rel\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-ID: <logo.png>\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte("Content of logo.png")) + "\r\n" +
+		"--rel--\r\n" +
+		"--alt--\r\n"
+
+	m, err := ReadMessage(strings.NewReader(eml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.parts) != 2 || m.parts[0].contentType != "text/plain" || m.parts[1].contentType != "text/html" {
+		t.Errorf("Invalid parts: %v", m.parts)
+	}
+	if len(m.embedded) != 1 || m.embedded[0].Header["Content-ID"][0] != "<logo.png>" {
+		t.Errorf("Invalid embedded files: %v", m.embedded)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, invalid := range []string{`filename=""`, "Content-ID: <>"} {
+		if strings.Contains(buf.String(), invalid) {
+			t.Errorf("Invalid %q in:\n%s", invalid, buf)
+		}
+	}
+}
+
+func TestReadMessageRepeatedFields(t *testing.T) {
+	eml := "Received: from b.example.com by c.example.com\r\n" +
+		"Received: from a.example.com by b.example.com\r\n" +
+		"From: from@example.com\r\n" +
+		"Keywords: a, b\r\n" +
+		"Subject: Test\r\n" +
+		"\r\n" +
+		"Hello\r\n"
+
+	m, err := ReadMessage(strings.NewReader(eml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		"Received: from b.example.com by c.example.com\r\n" +
+			"Received: from a.example.com by b.example.com\r\n",
+		"Keywords: a, b\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestReadMessageSinglePart(t *testing.T) {
+	eml := "From: from@example.com\r\n" +
+		"Subject: Test\r\n" +
+		"\r\n" +
+		"Hello\r\n"
+
+	m, err := ReadMessage(strings.NewReader(eml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetHeader("Subject"); len(got) != 1 || got[0] != "Test" {
+		t.Errorf("Invalid Subject, got %q", got)
+	}
+	if len(m.parts) != 1 || m.parts[0].contentType != "text/plain" {
+		t.Fatalf("Invalid parts: %v", m.parts)
+	}
+	buf := new(bytes.Buffer)
+	if err := m.parts[0].copier(buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "Hello\r\n"; got != want {
+		t.Errorf("Invalid body, got %q, want %q", got, want)
+	}
+}
+
+func TestReadMessageInvalid(t *testing.T) {
+	if _, err := ReadMessage(ioutil.NopCloser(strings.NewReader("Invalid"))); err == nil {
+		t.Error("ReadMessage() should fail with an invalid message")
+	}
+}
+
+func TestReadMessageAttachedMessage(t *testing.T) {
+	eml := "From: from@example.com\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"See attached.\r\n" +
+		"--outer\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"From: alice@example.com\r\n" +
+		"\r\n" +
+		"Original\r\n" +
+		"--outer--\r\n"
+
+	m, err := ReadMessage(strings.NewReader(eml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.attachments) != 1 || m.attachments[0].encoding != Unencoded {
+		t.Fatalf("Invalid attachments: %v", m.attachments)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Content-Transfer-Encoding: 7bit\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"From: alice@example.com\r\n" +
+		"\r\n" +
+		"Original\r\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("Invalid attached message, got:\n%s\nwant:\n%s", buf, want)
+	}
+}
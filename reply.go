@@ -0,0 +1,251 @@
+package gomail
+
+import (
+	"bytes"
+	"html"
+	"mime"
+	"net/mail"
+	"strings"
+)
+
+// NewReply returns a new message replying to original.
+//
+// The reply is sent to the Reply-To or From address of the original message
+// and, if replyAll is true, its To and Cc addresses are added in the Cc field.
+// The In-Reply-To and References fields are set so that the reply is threaded
+// with the original message, and its subject is prefixed with "Re: ". If the
+// original message has no Message-ID, one is generated as by MessageID.
+//
+// The body of the reply quotes the text and HTML parts of the original message.
+// The From field must be set before sending the reply and, with replyAll, the
+// address of the sender should be removed from the Cc field.
+func NewReply(original *Message, replyAll bool) *Message {
+	m := NewMessage(SetCharset(original.charset), SetEncoding(original.encoding))
+
+	to := original.header["Reply-To"]
+	if len(to) == 0 {
+		to = original.header["From"]
+	}
+	to = m.uniqueAddresses(to, nil)
+	if len(to) > 0 {
+		m.header["To"] = to
+	}
+	if replyAll {
+		cc := append(append([]string(nil), original.header["To"]...), original.header["Cc"]...)
+		if cc = m.uniqueAddresses(cc, to); len(cc) > 0 {
+			m.header["Cc"] = cc
+		}
+	}
+
+	m.setPrefixedSubject("Re:", original)
+	id := original.MessageID()
+	m.header["In-Reply-To"] = []string{id}
+	references := id
+	if refs := original.header["References"]; len(refs) > 0 {
+		references = strings.Join(refs, " ") + " " + id
+	}
+	m.header["References"] = []string{references}
+
+	for _, p := range original.bodyParts() {
+		content, err := p.content()
+		if err != nil {
+			continue
+		}
+		// The quoted content keeps the charset of its part.
+		charset, settings := m.quotedCharset(p)
+		author := authorText(original, charset)
+		intro := "On " + original.headerText("Date") + ", " + author + " wrote:"
+		if _, ok := original.header["Date"]; !ok {
+			intro = author + " wrote:"
+		}
+		switch p.contentType {
+		case "text/plain":
+			m.AddAlternative(p.contentType, "\r\n\r\n"+intro+"\r\n"+quoteText(content), settings...)
+		case "text/html":
+			m.AddAlternative(p.contentType, "<br><br><div>"+html.EscapeString(intro)+"</div>\r\n"+
+				"<blockquote style=\"margin:0 0 0 .8ex;border-left:1px #ccc solid;padding-left:1ex\">\r\n"+
+				content+"\r\n</blockquote>", settings...)
+		}
+	}
+
+	return m
+}
+
+// NewForward returns a new message forwarding original. Its subject is prefixed
+// with "Fwd: " and its recipients must be set before sending it.
+//
+// If asAttachment is true, the original message is attached to the new
+// message. Otherwise, its text and HTML parts are included in the body after a
+// summary of its header, and its attachments and embedded files are kept.
+func NewForward(original *Message, asAttachment bool) *Message {
+	m := NewMessage(SetCharset(original.charset), SetEncoding(original.encoding))
+	m.setPrefixedSubject("Fwd:", original)
+
+	if asAttachment {
+		m.AttachMessage(original)
+		return m
+	}
+
+	for _, p := range original.bodyParts() {
+		content, err := p.content()
+		if err != nil {
+			continue
+		}
+		charset, settings := m.quotedCharset(p)
+		var summary []string
+		for _, field := range []string{"From", "Date", "Subject", "To", "Cc"} {
+			if _, ok := original.header[field]; ok {
+				summary = append(summary, field+": "+original.headerTextIn(field, charset))
+			}
+		}
+		switch p.contentType {
+		case "text/plain":
+			m.AddAlternative(p.contentType, "---------- Forwarded message ---------\r\n"+
+				strings.Join(summary, "\r\n")+"\r\n\r\n"+content, settings...)
+		case "text/html":
+			lines := make([]string, len(summary))
+			for i, line := range summary {
+				lines[i] = html.EscapeString(line)
+			}
+			m.AddAlternative(p.contentType, "<div>---------- Forwarded message ---------<br>\r\n"+
+				strings.Join(lines, "<br>\r\n")+"</div><br>\r\n"+content, settings...)
+		}
+	}
+
+	m.attachments = copyFiles(original.attachments)
+	m.embedded = copyFiles(original.embedded)
+	return m
+}
+
+// setPrefixedSubject sets the Subject field of m to the subject of original
+// prefixed with prefix, unless it already starts with it.
+func (m *Message) setPrefixedSubject(prefix string, original *Message) {
+	subject := ""
+	if v := original.header["Subject"]; len(v) > 0 {
+		subject = v[0]
+	}
+	// The subject of original is already encoded so the prefix can be added as
+	// is.
+	if !strings.HasPrefix(strings.ToLower(original.headerText("Subject")), strings.ToLower(prefix)) {
+		subject = strings.TrimSpace(prefix + " " + subject)
+	}
+	m.header["Subject"] = []string{subject}
+}
+
+// headerText returns the decoded value of a header field of m.
+func (m *Message) headerText(field string) string {
+	values := make([]string, len(m.header[field]))
+	dec := new(mime.WordDecoder)
+	for i, v := range m.header[field] {
+		d, err := dec.DecodeHeader(v)
+		if err != nil {
+			d = v
+		}
+		values[i] = d
+	}
+	return strings.Join(values, ", ")
+}
+
+// headerTextIn returns the decoded value of a header field of m if it can be
+// written in the given charset, and its encoded value otherwise.
+func (m *Message) headerTextIn(field, charset string) string {
+	text := m.headerText(field)
+	if strings.EqualFold(charset, "UTF-8") || isASCII(text) {
+		return text
+	}
+	return strings.Join(m.header[field], ", ")
+}
+
+// quotedCharset returns the charset of the part of m quoting p, and the part
+// settings to use it.
+func (m *Message) quotedCharset(p *part) (string, []PartSetting) {
+	if p.charset == "" {
+		return m.charset, nil
+	}
+	return p.charset, []PartSetting{setPartCharset(p.charset)}
+}
+
+// authorText returns the author of original to be written in a part using the
+// given charset.
+func authorText(original *Message, charset string) string {
+	if strings.EqualFold(charset, "UTF-8") {
+		return original.headerText("From")
+	}
+	// Decoded names would not be in the charset of the part.
+	if from := original.header["From"]; len(from) > 0 {
+		if addr, err := parseAddress(from[0]); err == nil {
+			return addr
+		}
+	}
+	return ""
+}
+
+// content returns the unencoded content of the part.
+func (p *part) content() (string, error) {
+	buf := new(bytes.Buffer)
+	if err := p.copier(buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// quoteText prefixes each line of s with "> ".
+func quoteText(s string) string {
+	s = strings.Replace(strings.TrimRight(s, "\r\n"), "\r\n", "\n", -1)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, ">") {
+			lines[i] = ">" + line
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// uniqueAddresses returns the addresses of the address fields list that are
+// not in exclude, without duplicates.
+func (m *Message) uniqueAddresses(list, exclude []string) []string {
+	seen := make(map[string]bool)
+	for _, v := range exclude {
+		addrs, _ := mail.ParseAddressList(v)
+		for _, a := range addrs {
+			seen[strings.ToLower(a.Address)] = true
+		}
+	}
+
+	var unique []string
+	for _, v := range list {
+		addrs, err := mail.ParseAddressList(v)
+		if err != nil {
+			unique = append(unique, v)
+			continue
+		}
+		for _, a := range addrs {
+			if key := strings.ToLower(a.Address); !seen[key] {
+				seen[key] = true
+				if len(addrs) == 1 {
+					// Keep the field as is to avoid encoding the name again.
+					unique = append(unique, v)
+				} else {
+					unique = append(unique, m.FormatAddress(a.Address, a.Name))
+				}
+			}
+		}
+	}
+	return unique
+}
+
+func copyFiles(files []*file) []*file {
+	copies := make([]*file, len(files))
+	for i, f := range files {
+		header := make(map[string][]string, len(f.Header))
+		for k, v := range f.Header {
+			header[k] = v
+		}
+		c := *f
+		c.Header = header
+		copies[i] = &c
+	}
+	return copies
+}
@@ -0,0 +1,185 @@
+package gomail
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func getOriginalMessage() *Message {
+	m := NewMessage()
+	m.SetAddressHeader("From", "alice@example.com", "Alice")
+	m.SetHeader("To", "bob@example.com", "carol@example.com")
+	m.SetHeader("Cc", "dave@example.com, bob@example.com")
+	m.SetHeader("Subject", "¡Hola!")
+	m.SetHeader("Message-ID", "<2@example.com>")
+	m.SetHeader("References", "<1@example.com>")
+	m.SetDateHeader("Date", now())
+	m.SetBody("text/plain", "Hello\r\n\r\n> Previous\r\n")
+	m.AddAlternative("text/html", "<p>Hello</p>")
+	m.Attach(mockCopyFile("test.pdf"))
+	return m
+}
+
+func TestNewReply(t *testing.T) {
+	m := NewReply(getOriginalMessage(), false)
+
+	testHeader(t, m, "To", "\"Alice\" <alice@example.com>")
+	testHeader(t, m, "Cc")
+	testHeader(t, m, "Subject", "Re: =?UTF-8?q?=C2=A1Hola!?=")
+	testHeader(t, m, "In-Reply-To", "<2@example.com>")
+	testHeader(t, m, "References", "<1@example.com> <2@example.com>")
+
+	if len(m.parts) != 2 {
+		t.Fatalf("Invalid number of parts, got %d, want 2", len(m.parts))
+	}
+	testPartContent(t, m.parts[0], "\r\n\r\n"+
+		"On Wed, 25 Jun 2014 17:46:00 +0000, \"Alice\" <alice@example.com> wrote:\r\n"+
+		"> Hello\r\n"+
+		">\r\n"+
+		">> Previous")
+	if content, _ := m.parts[1].content(); !strings.Contains(content, "<blockquote") ||
+		!strings.Contains(content, "<p>Hello</p>") {
+		t.Errorf("Invalid HTML part: %q", content)
+	}
+	if len(m.attachments) != 0 {
+		t.Error("Attachments should not be kept in a reply")
+	}
+}
+
+func TestNewReplyCharset(t *testing.T) {
+	original, err := ReadMessage(strings.NewReader(
+		"From: =?ISO-8859-1?Q?Andr=E9?= <andre@example.com>\r\n" +
+			"Content-Type: text/plain; charset=ISO-8859-1\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n" +
+			"\r\n" +
+			"Caf=E9\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewReply(original, false)
+
+	if len(m.parts) != 1 {
+		t.Fatalf("Invalid number of parts, got %d, want 1", len(m.parts))
+	}
+	if m.parts[0].charset != "ISO-8859-1" {
+		t.Errorf("Invalid charset, got %q, want %q", m.parts[0].charset, "ISO-8859-1")
+	}
+	// The decoded name of the author is not written in ISO-8859-1.
+	testPartContent(t, m.parts[0], "\r\n\r\nandre@example.com wrote:\r\n> Caf\xe9")
+}
+
+func TestNewReplyAll(t *testing.T) {
+	original := getOriginalMessage()
+	original.SetHeader("Reply-To", "list@example.com")
+	m := NewReply(original, true)
+
+	testHeader(t, m, "To", "list@example.com")
+	testHeader(t, m, "Cc", "bob@example.com", "carol@example.com", "dave@example.com")
+}
+
+func TestNewReplySubject(t *testing.T) {
+	original := NewMessage()
+	original.SetHeader("From", "alice@example.com")
+	original.SetHeader("Subject", "RE: Test")
+	m := NewReply(original, false)
+
+	testHeader(t, m, "Subject", "RE: Test")
+	testHeader(t, m, "In-Reply-To", original.MessageID())
+	testHeader(t, m, "References", original.MessageID())
+}
+
+func TestNewForward(t *testing.T) {
+	m := NewForward(getOriginalMessage(), false)
+
+	testHeader(t, m, "Subject", "Fwd: =?UTF-8?q?=C2=A1Hola!?=")
+	testHeader(t, m, "To")
+	testHeader(t, m, "In-Reply-To")
+
+	if len(m.parts) != 2 {
+		t.Fatalf("Invalid number of parts, got %d, want 2", len(m.parts))
+	}
+	testPartContent(t, m.parts[0], "---------- Forwarded message ---------\r\n"+
+		"From: \"Alice\" <alice@example.com>\r\n"+
+		"Date: Wed, 25 Jun 2014 17:46:00 +0000\r\n"+
+		"Subject: ¡Hola!\r\n"+
+		"To: bob@example.com, carol@example.com\r\n"+
+		"Cc: dave@example.com, bob@example.com\r\n"+
+		"\r\n"+
+		"Hello\r\n\r\n> Previous\r\n")
+	if len(m.attachments) != 1 || m.attachments[0].Name != "test.pdf" {
+		t.Errorf("Invalid attachments: %v", m.attachments)
+	}
+}
+
+func TestNewForwardAttachedMessage(t *testing.T) {
+	original := getOriginalMessage()
+	attached := NewMessage()
+	attached.SetHeader("From", "carol@example.com")
+	attached.SetBody("text/plain", "Attached")
+	original.AttachMessage(attached)
+
+	m := NewForward(original, false)
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The message/rfc822 part must not be encoded in base64.
+	if want := "Content-Transfer-Encoding: 7bit\r\n" +
+		"Content-Type: message/rfc822\r\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("Invalid attached message, got:\n%s\nwant:\n%s", buf, want)
+	}
+}
+
+func TestNewForwardAsAttachment(t *testing.T) {
+	original := getOriginalMessage()
+	m := NewForward(original, true)
+	m.SetHeader("From", "bob@example.com")
+	m.SetHeader("To", "eve@example.com")
+	m.SetBody("text/plain", "See below.")
+
+	if len(m.attachments) != 1 {
+		t.Fatalf("Invalid number of attachments, got %d, want 1", len(m.attachments))
+	}
+	testHeader(t, &Message{header: m.attachments[0].Header}, "Content-Type", "message/rfc822")
+
+	buf := new(bytes.Buffer)
+	if err := m.attachments[0].CopyFunc(buf); err != nil {
+		t.Fatal(err)
+	}
+	want := new(bytes.Buffer)
+	if _, err := original.WriteTo(want); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := normalizeBoundaries(t, buf.String()), normalizeBoundaries(t, want.String()); got != want {
+		t.Errorf("Invalid attached message, got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func normalizeBoundaries(t *testing.T, s string) string {
+	for i, b := range getBoundaries(t, 2, s) {
+		s = strings.Replace(s, b, "_BOUNDARY_"+strconv.Itoa(i+1)+"_", -1)
+	}
+	return s
+}
+
+func testHeader(t *testing.T, m *Message, field string, want ...string) {
+	t.Helper()
+	if got := m.header[field]; !reflect.DeepEqual(got, want) && (len(got) != 0 || len(want) != 0) {
+		t.Errorf("Invalid %s field, got %q, want %q", field, got, want)
+	}
+}
+
+func testPartContent(t *testing.T, p *part, want string) {
+	t.Helper()
+	got, err := p.content()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Invalid part content, got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+package gomail
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// A RetrySender is a Sender that tries again to send an email when sending it
+// fails with a transient error. The delay between two attempts grows
+// exponentially.
+//
+// It is best used with a Pool or with the SendCloser returned by Dialer.Dial
+// since they replace the connections left in an unknown state by a network
+// error.
+type RetrySender struct {
+	// MaxAttempts is the maximum number of times an email is sent. By default,
+	// 3 attempts are made.
+	MaxAttempts int
+	// MinBackoff is the delay before the second attempt. It doubles after
+	// each attempt. By default, it is 1 second.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum delay between two attempts. By default, it is
+	// 1 minute.
+	MaxBackoff time.Duration
+	// ShouldRetry reports whether sending an email should be tried again after
+	// it failed with the given error. By default, IsTemporary is used.
+	ShouldRetry func(err error) bool
+
+	s Sender
+}
+
+// NewRetrySender returns a new RetrySender that sends emails using s.
+func NewRetrySender(s Sender) *RetrySender {
+	return &RetrySender{s: s}
+}
+
+const (
+	defaultMaxAttempts = 3
+	defaultMinBackoff  = time.Second
+	defaultMaxBackoff  = time.Minute
+)
+
+// Send sends an email, trying again if it fails with a transient error.
+func (r *RetrySender) Send(from string, to []string, msg io.WriterTo) error {
+	return r.SendContext(context.Background(), from, to, msg)
+}
+
+// SendContext sends an email, trying again if it fails with a transient error.
+// It gives up as soon as ctx is done, even while waiting between two attempts.
+func (r *RetrySender) SendContext(ctx context.Context, from string, to []string, msg io.WriterTo) error {
+	maxAttempts := r.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	shouldRetry := r.ShouldRetry
+	if shouldRetry == nil {
+		shouldRetry = IsTemporary
+	}
+
+	s := withContextSender(r.s)
+	rd, _ := r.s.(redialer)
+	var err error
+	broken := false
+	for attempt := 1; ; attempt++ {
+		if broken {
+			// The connection is in an unknown state: replace it.
+			err = rd.redial(ctx)
+			broken = err != nil
+		}
+		if !broken {
+			err = s.SendContext(ctx, from, to, msg)
+		}
+		if err == nil || attempt >= maxAttempts || !shouldRetry(err) {
+			return err
+		}
+
+		if isProtocolError(err) {
+			// Abort the failed mail transaction before starting a new one.
+			if rs, ok := r.s.(resetter); ok {
+				if rerr := rs.reset(ctx); rerr != nil {
+					return err
+				}
+			}
+		} else if rd != nil {
+			broken = true
+		}
+
+		select {
+		case <-time.After(r.backoff(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// resetter is implemented by the Senders that can abort a mail transaction.
+type resetter interface {
+	reset(ctx context.Context) error
+}
+
+// redialer is implemented by the Senders that can replace their connection to
+// the SMTP server.
+type redialer interface {
+	redial(ctx context.Context) error
+}
+
+// backoff returns the delay to wait after the given attempt. It is randomized
+// between half and the whole of the exponential delay to avoid many senders
+// retrying at the same time.
+func (r *RetrySender) backoff(attempt int) time.Duration {
+	min, max := r.MinBackoff, r.MaxBackoff
+	if min <= 0 {
+		min = defaultMinBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+
+	d := min
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	half := int64(d / 2)
+	return time.Duration(half + randInt63n(half+1))
+}
+
+// Stubbed out for tests.
+var randInt63n = rand.Int63n
+
+// IsTemporary reports whether err is a transient error, i.e. a temporary
+// negative reply (4xx) of the SMTP server or a network error. Permanent negative
+// replies (5xx) and context errors are not transient.
+func IsTemporary(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var smtpErr *SMTPError
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Temporary()
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,199 @@
+package gomail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRetrySender(t *testing.T) {
+	tests := []struct {
+		errs     []error
+		wantErr  bool
+		attempts int
+	}{
+		{
+			errs:     []error{&SMTPError{Code: 451}, &SMTPError{Code: 421}, nil},
+			attempts: 3,
+		},
+		{
+			errs:     []error{&net.OpError{Op: "read", Err: errors.New("connection reset")}, nil},
+			attempts: 2,
+		},
+		{
+			errs:     []error{&SMTPError{Code: 550}},
+			wantErr:  true,
+			attempts: 1,
+		},
+		{
+			errs:     []error{&SMTPError{Code: 451}, &SMTPError{Code: 451}, &SMTPError{Code: 451}, nil},
+			wantErr:  true,
+			attempts: 3,
+		},
+	}
+
+	for _, test := range tests {
+		attempts := 0
+		s := NewRetrySender(SendFunc(func(from string, to []string, msg io.WriterTo) error {
+			err := test.errs[attempts]
+			attempts++
+			return err
+		}))
+		s.MinBackoff = time.Millisecond
+
+		err := Send(s, getTestMessage())
+		if (err != nil) != test.wantErr {
+			t.Errorf("Send() with errors %v returned %v", test.errs, err)
+		}
+		if attempts != test.attempts {
+			t.Errorf("Invalid number of attempts with errors %v, got %d, want %d", test.errs, attempts, test.attempts)
+		}
+	}
+}
+
+func TestRetrySenderContext(t *testing.T) {
+	s := NewRetrySender(SendFunc(func(from string, to []string, msg io.WriterTo) error {
+		return &SMTPError{Code: 451}
+	}))
+	s.MinBackoff = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := SendContext(ctx, s, getTestMessage()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SendContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRetrySenderReset(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Mail " + testFrom,
+			"Rcpt " + testTo1,
+			"Reset",
+			"Mail " + testFrom,
+			"Rcpt " + testTo1,
+			"Quit",
+		},
+		addr:     addr(d.Host, d.Port),
+		rejected: map[string]bool{testTo1: true},
+	}
+	stubDial(t, testClient)
+
+	sc, err := d.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	s := NewRetrySender(sc)
+	s.MinBackoff = time.Millisecond
+	s.MaxAttempts = 2
+	s.ShouldRetry = func(error) bool { return true }
+	if err := Send(s, getTestMessage()); err == nil {
+		t.Error("Send() should fail when the recipient is always rejected")
+	}
+}
+
+func TestRetrySenderRedial(t *testing.T) {
+	servers := [][]smtpStep{
+		// The connection is lost in the middle of the mail transaction.
+		{
+			{"EHLO localhost", "250 " + testHost},
+			{"MAIL FROM:<" + testFrom + ">", "250 OK"},
+			{"RCPT TO:<" + testTo1 + ">", ""},
+		},
+		{
+			{"EHLO localhost", "250 " + testHost},
+			{"MAIL FROM:<" + testFrom + ">", "250 OK"},
+			{"RCPT TO:<" + testTo1 + ">", "250 OK"},
+			{"RCPT TO:<" + testTo2 + ">", "250 OK"},
+			{"DATA", "354 Go ahead"},
+			{".", "250 OK"},
+			{"QUIT", "221 Bye"},
+		},
+	}
+
+	dials := 0
+	errs := make(chan error, len(servers))
+	netDialContext = func(ctx context.Context, network, address string, d time.Duration) (net.Conn, error) {
+		if dials == len(servers) {
+			return nil, errors.New("too many dials")
+		}
+		server, client := net.Pipe()
+		go func(steps []smtpStep) { errs <- serveSMTP(server, steps) }(servers[dials])
+		dials++
+		return client, nil
+	}
+	smtpNewClient = realSMTPNewClient
+
+	d := &Dialer{Host: testHost, Port: testPort, StartTLSPolicy: NoStartTLS}
+	sc, err := d.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewRetrySender(sc)
+	s.MinBackoff = time.Millisecond
+	if err := Send(s, getTestMessage()); err != nil {
+		t.Error(err)
+	}
+	if err := sc.Close(); err != nil {
+		t.Error(err)
+	}
+	for range servers[:dials] {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if dials != len(servers) {
+		t.Errorf("Invalid number of connections, got %d, want %d", dials, len(servers))
+	}
+}
+
+func TestRetrySenderBackoff(t *testing.T) {
+	defer func(f func(int64) int64) { randInt63n = f }(randInt63n)
+	randInt63n = func(n int64) int64 { return n - 1 }
+
+	s := &RetrySender{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := s.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+
+	randInt63n = func(n int64) int64 { return 0 }
+	if got := s.backoff(1); got != 500*time.Millisecond {
+		t.Errorf("backoff(1) = %v, want %v", got, 500*time.Millisecond)
+	}
+}
+
+func TestIsTemporary(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{&SMTPError{Code: 421}, true},
+		{&SMTPError{Code: 554}, false},
+		{fmt.Errorf("gomail: could not send email 1: %w", &RecipientError{Err: &SMTPError{Code: 452}}), true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{io.EOF, true},
+		{context.Canceled, false},
+		{errors.New("gomail: invalid address"), false},
+	}
+
+	for _, test := range tests {
+		if got := IsTemporary(test.err); got != test.want {
+			t.Errorf("IsTemporary(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
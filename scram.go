@@ -0,0 +1,281 @@
+package gomail
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// scramAuth is an smtp.Auth that implements the SCRAM-SHA-1 and SCRAM-SHA-256
+// authentication mechanisms and their -PLUS variants, as defined in RFC 5802
+// and RFC 7677.
+type scramAuth struct {
+	mechanism string
+	username  string
+	password  string
+	hash      func() hash.Hash
+
+	// cbType and cbData are the channel binding type and data. cbType is
+	// empty if channel binding is not supported.
+	cbType string
+	cbData []byte
+	// plus defines whether channel binding is used.
+	plus bool
+
+	step            int
+	gs2Header       string
+	clientNonce     string
+	clientFirstBare string
+	serverSignature []byte
+}
+
+// SCRAMSHA1Auth returns an smtp.Auth that implements the SCRAM-SHA-1
+// authentication mechanism as defined in RFC 5802.
+//
+// The returned smtp.Auth keeps the state of an authentication exchange so it
+// must not be used by concurrent exchanges. Dialer.Auth can still be set to it
+// since the Dialer uses a copy for each connection.
+func SCRAMSHA1Auth(username, password string) smtp.Auth {
+	return newSCRAMAuth("SCRAM-SHA-1", username, password, nil)
+}
+
+// SCRAMSHA256Auth returns an smtp.Auth that implements the SCRAM-SHA-256
+// authentication mechanism as defined in RFC 7677. Like the one returned by
+// SCRAMSHA1Auth, it must not be used by concurrent exchanges.
+func SCRAMSHA256Auth(username, password string) smtp.Auth {
+	return newSCRAMAuth("SCRAM-SHA-256", username, password, nil)
+}
+
+// newSCRAMAuth returns a new scramAuth. If the mechanism ends with -PLUS, the
+// authentication is bound to the TLS connection described by cs. Otherwise, cs
+// is only used to tell the server that channel binding is supported.
+func newSCRAMAuth(mechanism, username, password string, cs *tls.ConnectionState) *scramAuth {
+	a := &scramAuth{
+		mechanism: mechanism,
+		username:  username,
+		password:  password,
+		hash:      sha256.New,
+		plus:      strings.HasSuffix(mechanism, "-PLUS"),
+	}
+	if strings.HasPrefix(mechanism, "SCRAM-SHA-1") {
+		a.hash = sha1.New
+	}
+	if cs != nil {
+		a.cbType, a.cbData = channelBinding(cs)
+	}
+	return a
+}
+
+// clone returns a copy of a without the state of an authentication exchange.
+func (a *scramAuth) clone() *scramAuth {
+	return &scramAuth{
+		mechanism: a.mechanism,
+		username:  a.username,
+		password:  a.password,
+		hash:      a.hash,
+		cbType:    a.cbType,
+		cbData:    a.cbData,
+		plus:      a.plus,
+	}
+}
+
+// channelBinding returns the channel binding type and data of a TLS connection
+// as defined in RFC 5929 and RFC 9266.
+func channelBinding(cs *tls.ConnectionState) (string, []byte) {
+	if cs.Version >= tls.VersionTLS13 {
+		data, err := cs.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, 32)
+		if err != nil {
+			return "", nil
+		}
+		return "tls-exporter", data
+	}
+	if len(cs.TLSUnique) == 0 {
+		return "", nil
+	}
+	return "tls-unique", cs.TLSUnique
+}
+
+func (a *scramAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	switch {
+	case a.plus && a.cbType == "":
+		return "", nil, errors.New("gomail: channel binding is not available")
+	case a.plus:
+		a.gs2Header = "p=" + a.cbType + ",,"
+	case a.cbType != "":
+		// The client supports channel binding but the server does not.
+		a.gs2Header = "y,,"
+	default:
+		a.gs2Header = "n,,"
+	}
+
+	nonce, err := newSCRAMNonce()
+	if err != nil {
+		return "", nil, err
+	}
+	a.step = 0
+	a.clientNonce = nonce
+	a.clientFirstBare = "n=" + escapeSASLName(a.username) + ",r=" + nonce
+	return a.mechanism, []byte(a.gs2Header + a.clientFirstBare), nil
+}
+
+func (a *scramAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		if a.serverSignature != nil {
+			// The server-final-message may be sent with the success reply.
+			if serverFinal, ok := successServerFinal(fromServer); ok {
+				return nil, a.verifyServerFinal(serverFinal)
+			}
+			return nil, errors.New("gomail: SCRAM server signature was not received")
+		}
+		return nil, nil
+	}
+
+	a.step++
+	switch a.step {
+	case 1:
+		return a.clientFinal(string(fromServer))
+	case 2:
+		// The SMTP server waits for an empty response before replying.
+		if err := a.verifyServerFinal(string(fromServer)); err != nil {
+			return nil, err
+		}
+		return []byte{}, nil
+	default:
+		return nil, fmt.Errorf("gomail: unexpected server challenge: %s", fromServer)
+	}
+}
+
+// clientFinal returns the client-final-message in reply to the
+// server-first-message.
+func (a *scramAuth) clientFinal(serverFirst string) ([]byte, error) {
+	attrs := parseSCRAMAttributes(serverFirst)
+	if e, ok := attrs['e']; ok {
+		return nil, fmt.Errorf("gomail: SCRAM authentication failed: %s", e)
+	}
+
+	nonce := attrs['r']
+	if !strings.HasPrefix(nonce, a.clientNonce) || len(nonce) == len(a.clientNonce) {
+		return nil, errors.New("gomail: invalid SCRAM server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs['s'])
+	if err != nil || len(salt) == 0 {
+		return nil, errors.New("gomail: invalid SCRAM salt")
+	}
+	iter, err := strconv.Atoi(attrs['i'])
+	if err != nil || iter <= 0 {
+		return nil, errors.New("gomail: invalid SCRAM iteration count")
+	}
+
+	cbInput := []byte(a.gs2Header)
+	if a.plus {
+		cbInput = append(cbInput, a.cbData...)
+	}
+	clientFinalWithoutProof := "c=" + base64.StdEncoding.EncodeToString(cbInput) + ",r=" + nonce
+	authMessage := []byte(a.clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof)
+
+	saltedPassword := pbkdf2(a.hash, []byte(a.password), salt, iter)
+	clientKey := a.hmac(saltedPassword, []byte("Client Key"))
+	h := a.hash()
+	h.Write(clientKey)
+	storedKey := h.Sum(nil)
+	clientSignature := a.hmac(storedKey, authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+
+	serverKey := a.hmac(saltedPassword, []byte("Server Key"))
+	a.serverSignature = a.hmac(serverKey, authMessage)
+
+	return []byte(clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// successServerFinal returns the server-final-message found at the end of the
+// text of a success reply, either as is or encoded in base64.
+func successServerFinal(text []byte) (string, bool) {
+	fields := strings.Fields(string(text))
+	if len(fields) == 0 {
+		return "", false
+	}
+	last := fields[len(fields)-1]
+	if strings.HasPrefix(last, "v=") || strings.HasPrefix(last, "e=") {
+		return last, true
+	}
+	b, err := base64.StdEncoding.DecodeString(last)
+	if err != nil || !(bytes.HasPrefix(b, []byte("v=")) || bytes.HasPrefix(b, []byte("e="))) {
+		return "", false
+	}
+	return string(b), true
+}
+
+// verifyServerFinal checks the server-final-message to make sure the server
+// knows the password too.
+func (a *scramAuth) verifyServerFinal(serverFinal string) error {
+	attrs := parseSCRAMAttributes(serverFinal)
+	if e, ok := attrs['e']; ok {
+		return fmt.Errorf("gomail: SCRAM authentication failed: %s", e)
+	}
+	v, err := base64.StdEncoding.DecodeString(attrs['v'])
+	if err != nil || subtle.ConstantTimeCompare(v, a.serverSignature) != 1 {
+		return errors.New("gomail: invalid SCRAM server signature")
+	}
+	a.serverSignature = nil
+	return nil
+}
+
+func (a *scramAuth) hmac(key, data []byte) []byte {
+	mac := hmac.New(a.hash, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// parseSCRAMAttributes parses a comma-separated list of SCRAM attributes.
+func parseSCRAMAttributes(s string) map[byte]string {
+	attrs := make(map[byte]string)
+	for _, field := range strings.Split(s, ",") {
+		if len(field) >= 2 && field[1] == '=' {
+			attrs[field[0]] = field[2:]
+		}
+	}
+	return attrs
+}
+
+// pbkdf2 implements the Hi function of RFC 5802, which is PBKDF2 with an output
+// length equal to the size of the hash.
+func pbkdf2(h func() hash.Hash, password, salt []byte, iter int) []byte {
+	mac := hmac.New(h, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	result := make([]byte, len(u))
+	copy(result, u)
+	for i := 1; i < iter; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result
+}
+
+// Stubbed out for tests.
+var newSCRAMNonce = func() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
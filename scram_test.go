@@ -0,0 +1,237 @@
+package gomail
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/smtp"
+	"sync"
+	"testing"
+)
+
+func TestSCRAM(t *testing.T) {
+	tests := []struct {
+		auth        smtp.Auth
+		nonce       string
+		serverFirst string
+		clientFinal string
+		serverFinal string
+	}{
+		// Test vector of RFC 5802, section 5.
+		{
+			auth:        SCRAMSHA1Auth("user", "pencil"),
+			nonce:       "fyko+d2lbbFgONRv9qkxdawL",
+			serverFirst: "r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+			clientFinal: "c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+			serverFinal: "v=rmF9pqV8S7suAoZWja4dJRkFsKQ=",
+		},
+		// Test vector of RFC 7677, section 3.
+		{
+			auth:        SCRAMSHA256Auth("user", "pencil"),
+			nonce:       "rOprNGfwEbeRWgbNEkqO",
+			serverFirst: "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			clientFinal: "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+			serverFinal: "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+		},
+	}
+
+	defer func(f func() (string, error)) { newSCRAMNonce = f }(newSCRAMNonce)
+	for _, test := range tests {
+		nonce := test.nonce
+		newSCRAMNonce = func() (string, error) { return nonce, nil }
+
+		_, toServer, err := test.auth.Start(&smtp.ServerInfo{Name: testHost})
+		if err != nil {
+			t.Fatalf("Start(): %v", err)
+		}
+		if want := "n,,n=user,r=" + test.nonce; string(toServer) != want {
+			t.Errorf("Invalid client-first-message, got %q, want %q", toServer, want)
+		}
+
+		toServer, err = test.auth.Next([]byte(test.serverFirst), true)
+		if err != nil {
+			t.Fatalf("Next(): %v", err)
+		}
+		if string(toServer) != test.clientFinal {
+			t.Errorf("Invalid client-final-message, got %q, want %q", toServer, test.clientFinal)
+		}
+
+		toServer, err = test.auth.Next([]byte(test.serverFinal), true)
+		if err != nil {
+			t.Errorf("Next(): %v", err)
+		}
+		if toServer == nil || len(toServer) != 0 {
+			t.Errorf("Invalid reply to the server-final-message, got %q, want an empty response", toServer)
+		}
+		if _, err = test.auth.Next([]byte("2.7.0 Authentication successful"), false); err != nil {
+			t.Errorf("Next(): %v", err)
+		}
+	}
+}
+
+func TestClientSCRAM(t *testing.T) {
+	const (
+		nonce       = "rOprNGfwEbeRWgbNEkqO"
+		serverFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+		clientFinal = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+		serverFinal = "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="
+	)
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	defer func(f func() (string, error)) { newSCRAMNonce = f }(newSCRAMNonce)
+	newSCRAMNonce = func() (string, error) { return nonce, nil }
+
+	tests := [][]smtpStep{
+		// The server-final-message is a challenge followed by an empty
+		// response.
+		{
+			{"AUTH SCRAM-SHA-256 " + b64("n,,n=user,r="+nonce), "334 " + b64(serverFirst)},
+			{b64(clientFinal), "334 " + b64(serverFinal)},
+			{"", "235 2.7.0 Authentication successful"},
+			{"MAIL FROM:<" + testFrom + ">", "250 OK"},
+		},
+		// The server-final-message is sent with the success reply.
+		{
+			{"AUTH SCRAM-SHA-256 " + b64("n,,n=user,r="+nonce), "334 " + b64(serverFirst)},
+			{b64(clientFinal), "235 2.7.0 " + b64(serverFinal)},
+			{"MAIL FROM:<" + testFrom + ">", "250 OK"},
+		},
+	}
+
+	for _, steps := range tests {
+		server, client := net.Pipe()
+		done := make(chan error, 1)
+		go func(steps []smtpStep) {
+			done <- serveSMTP(server, append([]smtpStep{
+				{"EHLO localhost", "250-" + testHost + "\r\n250 AUTH SCRAM-SHA-256"},
+			}, steps...))
+		}(steps)
+
+		c, err := realSMTPNewClient(client, testHost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Hello("localhost"); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Auth(SCRAMSHA256Auth("user", "pencil")); err != nil {
+			t.Errorf("Auth(): %v", err)
+		}
+		if err := c.Mail(testFrom); err != nil {
+			t.Errorf("Mail(): %v", err)
+		}
+		c.Close()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSCRAMInvalidServerSignature(t *testing.T) {
+	defer func(f func() (string, error)) { newSCRAMNonce = f }(newSCRAMNonce)
+	newSCRAMNonce = func() (string, error) { return "rOprNGfwEbeRWgbNEkqO", nil }
+
+	auth := SCRAMSHA256Auth("user", "pencil")
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: testHost}); err != nil {
+		t.Fatal(err)
+	}
+	serverFirst := "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+	if _, err := auth.Next([]byte(serverFirst), true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Next([]byte("v=AAAA"), true); err == nil {
+		t.Error("Next() should fail with an invalid server signature")
+	}
+}
+
+func TestSCRAMChannelBinding(t *testing.T) {
+	cs := &tls.ConnectionState{Version: tls.VersionTLS12, TLSUnique: []byte("unique")}
+
+	a := newSCRAMAuth("SCRAM-SHA-256-PLUS", "user", "pencil", cs)
+	_, toServer, err := a.Start(&smtp.ServerInfo{Name: testHost, TLS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "p=tls-unique,,n=user,r="; string(toServer[:len(want)]) != want {
+		t.Errorf("Invalid client-first-message, got %q, want prefix %q", toServer, want)
+	}
+
+	a = newSCRAMAuth("SCRAM-SHA-256", "user", "pencil", cs)
+	_, toServer, err = a.Start(&smtp.ServerInfo{Name: testHost, TLS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "y,,n=user,r="; string(toServer[:len(want)]) != want {
+		t.Errorf("Invalid client-first-message, got %q, want prefix %q", toServer, want)
+	}
+}
+
+func TestDialerAuthNegotiation(t *testing.T) {
+	tests := []struct {
+		auths string
+		want  string
+	}{
+		{"PLAIN LOGIN SCRAM-SHA-1 SCRAM-SHA-256 CRAM-MD5", "SCRAM-SHA-256"},
+		{"PLAIN SCRAM-SHA-1-PLUS SCRAM-SHA-1", "SCRAM-SHA-1"},
+		{"PLAIN CRAM-MD5", "CRAM-MD5"},
+		{"PLAIN LOGIN", "PLAIN"},
+		{"LOGIN", "LOGIN"},
+	}
+
+	d := &Dialer{Host: testHost, Port: testPort, Username: "user", Password: "pencil"}
+	for _, test := range tests {
+		a, err := d.auth(context.Background(), &authClient{auths: test.auths})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, err := a.Start(&smtp.ServerInfo{Name: testHost, TLS: true, Auth: []string{test.want}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("Invalid mechanism for %q, got %q, want %q", test.auths, got, test.want)
+		}
+	}
+}
+
+func TestDialerSCRAMAuthConcurrent(t *testing.T) {
+	auth := SCRAMSHA256Auth("user", "pencil")
+	d := &Dialer{Host: testHost, Port: testPort, Auth: auth}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a, err := d.auth(context.Background(), &authClient{auths: "SCRAM-SHA-256"})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, _, err := a.Start(&smtp.ServerInfo{Name: testHost, TLS: true}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if a := auth.(*scramAuth); a.clientNonce != "" {
+		t.Error("The Dialer should authenticate with a copy of its Auth field")
+	}
+}
+
+// authClient is an smtpClient that advertises the given authentication
+// mechanisms.
+type authClient struct {
+	smtpClient
+	auths string
+}
+
+func (c *authClient) Extension(ext string) (bool, string) {
+	return ext == "AUTH", c.auths
+}
+
+func (c *authClient) TLSConnectionState() (tls.ConnectionState, bool) {
+	return tls.ConnectionState{}, false
+}
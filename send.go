@@ -1,6 +1,7 @@
 package gomail
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -20,6 +21,15 @@ type SendCloser interface {
 	Close() error
 }
 
+// ContextSender is the interface that wraps the SendContext method.
+//
+// SendContext sends an email to the given addresses. If the context expires or
+// is canceled before the email is sent, SendContext gives up and returns the
+// context's error.
+type ContextSender interface {
+	SendContext(ctx context.Context, from string, to []string, msg io.WriterTo) error
+}
+
 // A SendFunc is a function that sends emails to the given addresses.
 //
 // The SendFunc type is an adapter to allow the use of ordinary functions as
@@ -36,14 +46,127 @@ func (f SendFunc) Send(from string, to []string, msg io.WriterTo) error {
 func Send(s Sender, msg ...*Message) error {
 	for i, m := range msg {
 		if err := send(s, m); err != nil {
-			return fmt.Errorf("gomail: could not send email %d: %v", i+1, err)
+			return fmt.Errorf("gomail: could not send email %d: %w", i+1, err)
 		}
 	}
 
 	return nil
 }
 
+// SendContext sends emails using the given Sender and context. If s implements
+// ContextSender, the context is passed along to each call to SendContext.
+// Otherwise, s is adapted so that the context is checked before each email is
+// sent.
+func SendContext(ctx context.Context, s Sender, msg ...*Message) error {
+	cs := withContextSender(s)
+	for i, m := range msg {
+		if err := sendContext(ctx, cs, m); err != nil {
+			return fmt.Errorf("gomail: could not send email %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// withContextSender returns s as a ContextSender.
+func withContextSender(s Sender) ContextSender {
+	if cs, ok := s.(ContextSender); ok {
+		return cs
+	}
+	return contextSender{s}
+}
+
+// contextSender adapts a Sender that does not support contexts.
+type contextSender struct {
+	Sender
+}
+
+func (s contextSender) SendContext(ctx context.Context, from string, to []string, msg io.WriterTo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Send(from, to, msg)
+}
+
+// A Deliverer is a Sender that reports which recipients of an email were
+// accepted by the SMTP server.
+type Deliverer interface {
+	Deliver(ctx context.Context, from string, to []string, msg io.WriterTo) (*Delivery, error)
+}
+
+// A Delivery reports which recipients of an email were accepted or rejected by
+// the SMTP server.
+type Delivery struct {
+	Accepted []string
+	Rejected []*RecipientError
+}
+
+func (d *Delivery) err() error {
+	if len(d.Rejected) == 1 {
+		return d.Rejected[0]
+	}
+	return fmt.Errorf("gomail: all %d recipients were rejected, the first one with: %w",
+		len(d.Rejected), d.Rejected[0].Err)
+}
+
+// A RecipientError is returned when the SMTP server rejects a recipient.
+type RecipientError struct {
+	// Address is the rejected address.
+	Address string
+	// Code is the reply code sent by the SMTP server.
+	Code int
+	// Err is the error returned by the SMTP server.
+	Err error
+}
+
+func newRecipientError(addr string, err error) (*RecipientError, bool) {
+	if e, ok := err.(*SMTPError); ok {
+		return &RecipientError{Address: addr, Code: e.Code, Err: err}, true
+	}
+	return nil, false
+}
+
+func (e *RecipientError) Error() string {
+	return fmt.Sprintf("gomail: recipient %q rejected: %v", e.Address, e.Err)
+}
+
+// Unwrap returns the error returned by the SMTP server.
+func (e *RecipientError) Unwrap() error {
+	return e.Err
+}
+
+// Deliver sends an email using the given Sender and reports which recipients
+// were accepted by the SMTP server. If s does not implement Deliverer, all the
+// recipients are considered as accepted when the email is sent successfully.
+//
+// When using a Dialer with SkipRejectedRecipients set, the email is sent as long
+// as at least one recipient is accepted. Otherwise, Deliver gives up as soon as
+// a recipient is rejected.
+func Deliver(ctx context.Context, s Sender, m *Message) (*Delivery, error) {
+	from, err := m.getFrom()
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := m.getRecipients()
+	if err != nil {
+		return nil, err
+	}
+
+	if d, ok := s.(Deliverer); ok {
+		return d.Deliver(ctx, from, to, m)
+	}
+	if err := withContextSender(s).SendContext(ctx, from, to, m); err != nil {
+		return nil, err
+	}
+	return &Delivery{Accepted: to}, nil
+}
+
 func send(s Sender, m *Message) error {
+	return sendContext(context.Background(), contextSender{s}, m)
+}
+
+func sendContext(ctx context.Context, s ContextSender, m *Message) error {
 	from, err := m.getFrom()
 	if err != nil {
 		return err
@@ -54,7 +177,7 @@ func send(s Sender, m *Message) error {
 		return err
 	}
 
-	if err := s.Send(from, to, m); err != nil {
+	if err := s.SendContext(ctx, from, to, m); err != nil {
 		return err
 	}
 
@@ -62,6 +185,10 @@ func send(s Sender, m *Message) error {
 }
 
 func (m *Message) getFrom() (string, error) {
+	if m.envelopeFrom != "" {
+		return parseAddress(m.envelopeFrom)
+	}
+
 	from := m.header["Sender"]
 	if len(from) == 0 {
 		from = m.header["From"]
@@ -74,6 +201,18 @@ func (m *Message) getFrom() (string, error) {
 }
 
 func (m *Message) getRecipients() ([]string, error) {
+	if len(m.envelopeTo) > 0 {
+		list := make([]string, 0, len(m.envelopeTo))
+		for _, a := range m.envelopeTo {
+			addr, err := parseAddress(a)
+			if err != nil {
+				return nil, err
+			}
+			list = addAddress(list, addr)
+		}
+		return list, nil
+	}
+
 	n := 0
 	for _, field := range []string{"To", "Cc", "Bcc"} {
 		if addresses, ok := m.header[field]; ok {
@@ -2,6 +2,7 @@ package gomail
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"reflect"
 	"testing"
@@ -16,6 +17,7 @@ const (
 		"From: " + testFrom + "\r\n" +
 		"Mime-Version: 1.0\r\n" +
 		"Date: Wed, 25 Jun 2014 17:46:00 +0000\r\n" +
+		"Message-ID: <1403718360.test@example.com>\r\n" +
 		"Content-Type: text/plain; charset=UTF-8\r\n" +
 		"Content-Transfer-Encoding: quoted-printable\r\n" +
 		"\r\n" +
@@ -50,6 +52,78 @@ func TestSend(t *testing.T) {
 	}
 }
 
+func TestSendContext(t *testing.T) {
+	s := stubSend(t, testFrom, []string{testTo1, testTo2}, testMsg)
+	if err := SendContext(context.Background(), s, getTestMessage()); err != nil {
+		t.Errorf("SendContext(): %v", err)
+	}
+}
+
+func TestSendContextCanceled(t *testing.T) {
+	s := mockSender(func(from string, to []string, msg io.WriterTo) error {
+		t.Error("Send() should not be called when the context is canceled")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := SendContext(ctx, s, getTestMessage()); err == nil {
+		t.Error("SendContext() should fail when the context is canceled")
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	s := stubSend(t, testFrom, []string{testTo1, testTo2}, testMsg)
+	delivery, err := Deliver(context.Background(), s, getTestMessage())
+	if err != nil {
+		t.Fatalf("Deliver(): %v", err)
+	}
+	if !reflect.DeepEqual(delivery.Accepted, []string{testTo1, testTo2}) {
+		t.Errorf("Invalid accepted recipients, got %v, want %v", delivery.Accepted, []string{testTo1, testTo2})
+	}
+}
+
+func TestSendEnvelope(t *testing.T) {
+	bounce := VERPAddress("bounces@example.org", "bcc@example.com")
+	if want := "bounces+bcc=example.com@example.org"; bounce != want {
+		t.Errorf("Invalid VERP address, got %q, want %q", bounce, want)
+	}
+
+	m := getTestMessage()
+	m.SetEnvelopeFrom(bounce)
+	m.SetEnvelopeTo("Bcc <bcc@example.com>", "bcc@example.com", testTo1)
+	s := stubSend(t, bounce, []string{"bcc@example.com", testTo1}, testMsg)
+	if err := Send(s, m); err != nil {
+		t.Errorf("Send(): %v", err)
+	}
+
+	m.SetEnvelopeFrom("")
+	m.SetEnvelopeTo()
+	s = stubSend(t, testFrom, []string{testTo1, testTo2}, testMsg)
+	if err := Send(s, m); err != nil {
+		t.Errorf("Send(): %v", err)
+	}
+}
+
+func TestSendInvalidEnvelope(t *testing.T) {
+	s := mockSender(func(from string, to []string, msg io.WriterTo) error {
+		t.Error("Send() should not be called with an invalid envelope")
+		return nil
+	})
+
+	m := getTestMessage()
+	m.SetEnvelopeTo("invalid")
+	if err := Send(s, m); err == nil {
+		t.Error("Send() should fail with an invalid envelope recipient")
+	}
+
+	m = getTestMessage()
+	m.SetEnvelopeFrom("invalid")
+	if err := Send(s, m); err == nil {
+		t.Error("Send() should fail with an invalid envelope sender")
+	}
+}
+
 func getTestMessage() *Message {
 	m := NewMessage()
 	m.SetHeader("From", testFrom)
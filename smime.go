@@ -0,0 +1,309 @@
+package gomail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"sort"
+	"time"
+)
+
+// SetSMIMESigner is a message setting to sign the email with S/MIME as defined
+// in RFC 8551. The content of the email is sent in a multipart/signed entity
+// along with an application/pkcs7-signature detached signature.
+//
+// cert is the certificate of the signer and key its RSA or ECDSA private key.
+// The intermediate certificates of its chain can be included in the signature
+// so that recipients can verify it.
+//
+// Since signed content must not be modified in transit, the parts of the email
+// should not use the Unencoded encoding.
+//
+// When used with SetSMIMERecipients, the settings are applied in the given
+// order: the email is signed then encrypted if SetSMIMESigner comes first.
+func SetSMIMESigner(cert *x509.Certificate, key crypto.Signer, intermediates ...*x509.Certificate) MessageSetting {
+	return func(m *Message) {
+		s := &smimeSigner{
+			cert:  cert,
+			key:   key,
+			chain: intermediates,
+		}
+		m.wrappers = append(m.wrappers, s.wrap)
+	}
+}
+
+// SetSMIMERecipients is a message setting to encrypt the email with S/MIME as
+// defined in RFC 8551. The content of the email is encrypted with AES-256-CBC
+// so that it can only be read by the owners of the given RSA certificates.
+//
+// The sender should usually include its own certificate to be able to read the
+// email later.
+func SetSMIMERecipients(recipients ...*x509.Certificate) MessageSetting {
+	return func(m *Message) {
+		e := &smimeEncrypter{recipients: recipients}
+		m.wrappers = append(m.wrappers, e.wrap)
+	}
+}
+
+var (
+	oidData                 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidAttributeContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeDigest      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningTime = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidAES256CBC            = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	asn1Null                = []byte{0x05, 0x00}
+	errUnsupportedSMIMEKey  = errors.New("gomail: unsupported S/MIME key type")
+	errMissingSMIMECert     = errors.New("gomail: S/MIME certificate is missing")
+)
+
+type smimeSigner struct {
+	cert  *x509.Certificate
+	key   crypto.Signer
+	chain []*x509.Certificate
+}
+
+func (s *smimeSigner) wrap(m *Message, w io.Writer, entity []byte) error {
+	sig, err := s.sign(entity)
+	if err != nil {
+		return err
+	}
+
+	boundary := m.newBoundary()
+	mw := &messageWriter{w: w}
+	mw.writeString("Content-Type: multipart/signed;\r\n" +
+		" protocol=\"application/pkcs7-signature\"; micalg=sha-256;\r\n" +
+		" boundary=" + boundary + "\r\n\r\n")
+	mw.writeString("--" + boundary + "\r\n")
+	mw.Write(entity)
+	mw.writeString("\r\n--" + boundary + "\r\n")
+	mw.writeString("Content-Type: application/pkcs7-signature; name=\"smime.p7s\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"Content-Disposition: attachment; filename=\"smime.p7s\"\r\n\r\n")
+	writeBase64(mw, sig)
+	mw.writeString("\r\n--" + boundary + "--\r\n")
+	return mw.err
+}
+
+// sign returns a detached CMS SignedData of content, as defined in RFC 5652.
+func (s *smimeSigner) sign(content []byte) ([]byte, error) {
+	if s.cert == nil {
+		return nil, errMissingSMIMECert
+	}
+
+	var sigAlg []byte
+	switch s.key.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg = derSequence(derMarshal(oidRSAEncryption), asn1Null)
+	case *ecdsa.PublicKey:
+		sigAlg = derSequence(derMarshal(oidECDSAWithSHA256))
+	default:
+		return nil, errUnsupportedSMIMEKey
+	}
+	digestAlg := derSequence(derMarshal(oidSHA256))
+
+	digest := sha256.Sum256(content)
+	attrs := [][]byte{
+		derAttribute(oidAttributeContentType, derMarshal(oidData)),
+		derAttribute(oidAttributeSigningTime, derTime(now())),
+		derAttribute(oidAttributeDigest, derMarshal(digest[:])),
+	}
+
+	// The signature covers the DER encoding of the signed attributes as a SET
+	// OF, while they are sent with an implicit [0] tag.
+	signedAttrs := derSet(attrs...)
+	h := sha256.Sum256(signedAttrs)
+	signature, err := s.key.Sign(rand.Reader, h[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	signedAttrs[0] = 0xa0
+
+	signerInfo := derSequence(
+		derMarshal(1),
+		issuerAndSerial(s.cert),
+		digestAlg,
+		signedAttrs,
+		sigAlg,
+		derMarshal(signature),
+	)
+
+	certs := [][]byte{s.cert.Raw}
+	for _, c := range s.chain {
+		certs = append(certs, c.Raw)
+	}
+
+	signedData := derSequence(
+		derMarshal(1),
+		derSet(digestAlg),
+		derSequence(derMarshal(oidData)),
+		derTagged(0, bytes.Join(certs, nil)),
+		derSet(signerInfo),
+	)
+
+	return derSequence(derMarshal(oidSignedData), derTagged(0, signedData)), nil
+}
+
+type smimeEncrypter struct {
+	recipients []*x509.Certificate
+}
+
+func (e *smimeEncrypter) wrap(m *Message, w io.Writer, entity []byte) error {
+	enveloped, err := e.encrypt(entity)
+	if err != nil {
+		return err
+	}
+
+	mw := &messageWriter{w: w}
+	mw.writeString("Content-Type: application/pkcs7-mime; smime-type=enveloped-data;\r\n" +
+		" name=\"smime.p7m\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"Content-Disposition: attachment; filename=\"smime.p7m\"\r\n\r\n")
+	writeBase64(mw, enveloped)
+	return mw.err
+}
+
+// encrypt returns a CMS EnvelopedData of content, as defined in RFC 5652.
+func (e *smimeEncrypter) encrypt(content []byte) ([]byte, error) {
+	if len(e.recipients) == 0 {
+		return nil, errMissingSMIMECert
+	}
+
+	key := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(content)%aes.BlockSize
+	encrypted := make([]byte, len(content)+padding)
+	copy(encrypted, content)
+	for i := len(content); i < len(encrypted); i++ {
+		encrypted[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	var recipientInfos [][]byte
+	for _, cert := range e.recipients {
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errUnsupportedSMIMEKey
+		}
+		encryptedKey, err := rsa.EncryptPKCS1v15(rand.Reader, pub, key)
+		if err != nil {
+			return nil, err
+		}
+		recipientInfos = append(recipientInfos, derSequence(
+			derMarshal(0),
+			issuerAndSerial(cert),
+			derSequence(derMarshal(oidRSAEncryption), asn1Null),
+			derMarshal(encryptedKey),
+		))
+	}
+
+	envelopedData := derSequence(
+		derMarshal(0),
+		derSet(recipientInfos...),
+		derSequence(
+			derMarshal(oidData),
+			derSequence(derMarshal(oidAES256CBC), derMarshal(iv)),
+			derImplicitBytes(0, encrypted),
+		),
+	)
+
+	return derSequence(derMarshal(oidEnvelopedData), derTagged(0, envelopedData)), nil
+}
+
+// writeBase64 writes data encoded in base64 with lines of 76 characters.
+func writeBase64(w io.Writer, data []byte) {
+	wc := base64.NewEncoder(base64.StdEncoding, newBase64LineWriter(w))
+	wc.Write(data)
+	wc.Close()
+}
+
+func issuerAndSerial(cert *x509.Certificate) []byte {
+	return derSequence(cert.RawIssuer, derMarshal(cert.SerialNumber))
+}
+
+func derAttribute(oid asn1.ObjectIdentifier, value []byte) []byte {
+	return derSequence(derMarshal(oid), derSet(value))
+}
+
+// derTime encodes t as an UTCTime or, after 2049, as a GeneralizedTime as
+// required by RFC 5652, section 11.3.
+func derTime(t time.Time) []byte {
+	t = t.UTC()
+	if t.Year() >= 2050 {
+		return derMarshalWithParams(t, "generalized")
+	}
+	return derMarshalWithParams(t, "utc")
+}
+
+// derMarshal returns the DER encoding of a value that is known to be valid,
+// like an integer, an object identifier or a byte slice.
+func derMarshal(v interface{}) []byte {
+	return derMarshalWithParams(v, "")
+}
+
+func derMarshalWithParams(v interface{}, params string) []byte {
+	b, err := asn1.MarshalWithParams(v, params)
+	if err != nil {
+		panic("gomail: invalid ASN.1 value: " + err.Error())
+	}
+	return b
+}
+
+func derSequence(elems ...[]byte) []byte {
+	return derRaw(asn1.ClassUniversal, asn1.TagSequence, true, bytes.Join(elems, nil))
+}
+
+// derSet returns a DER SET OF. Its elements are sorted as required by DER.
+func derSet(elems ...[]byte) []byte {
+	sorted := make([][]byte, len(elems))
+	copy(sorted, elems)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	return derRaw(asn1.ClassUniversal, asn1.TagSet, true, bytes.Join(sorted, nil))
+}
+
+// derTagged returns content with a constructed context-specific tag.
+func derTagged(tag int, content []byte) []byte {
+	return derRaw(asn1.ClassContextSpecific, tag, true, content)
+}
+
+// derImplicitBytes returns an OCTET STRING with an implicit context-specific
+// tag.
+func derImplicitBytes(tag int, b []byte) []byte {
+	return derRaw(asn1.ClassContextSpecific, tag, false, b)
+}
+
+func derRaw(class, tag int, compound bool, content []byte) []byte {
+	return derMarshal(asn1.RawValue{
+		Class:      class,
+		Tag:        tag,
+		IsCompound: compound,
+		Bytes:      content,
+	})
+}
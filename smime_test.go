@@ -0,0 +1,339 @@
+package gomail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSMIMESign(t *testing.T) {
+	for _, name := range []string{"RSA", "ECDSA"} {
+		t.Run(name, func(t *testing.T) {
+			cert, key := newTestCertificate(t, name)
+			m := NewMessage(SetSMIMESigner(cert, key))
+			m.SetHeader("From", "from@example.com")
+			m.SetHeader("To", "to@example.com")
+			m.SetBody("text/plain", "Test")
+
+			header, body := splitWrittenMessage(t, m)
+			mediaType, params, err := mime.ParseMediaType(headerValue(header, "Content-Type"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mediaType != "multipart/signed" ||
+				params["protocol"] != "application/pkcs7-signature" ||
+				params["micalg"] != "sha-256" {
+				t.Fatalf("Invalid Content-Type: %s %v", mediaType, params)
+			}
+
+			entity, sig := splitSignedEntity(t, body, params["boundary"])
+			if !strings.Contains(entity, "Content-Type: text/plain; charset=UTF-8\r\n") {
+				t.Errorf("Invalid signed entity: %q", entity)
+			}
+			verifySMIMESignature(t, []byte(entity), sig, cert)
+		})
+	}
+}
+
+func TestSMIMEEncrypt(t *testing.T) {
+	cert, key := newTestCertificate(t, "RSA")
+	other, _ := newTestCertificate(t, "RSA")
+	m := NewMessage(SetSMIMERecipients(other, cert))
+	m.SetHeader("From", "from@example.com")
+	m.SetHeader("To", "to@example.com")
+	m.SetBody("text/plain", "Test")
+
+	header, body := splitWrittenMessage(t, m)
+	mediaType, params, err := mime.ParseMediaType(headerValue(header, "Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "application/pkcs7-mime" || params["smime-type"] != "enveloped-data" {
+		t.Fatalf("Invalid Content-Type: %s %v", mediaType, params)
+	}
+
+	entity := decryptSMIME(t, decodeBase64(t, body), cert, key.(*rsa.PrivateKey))
+	h, content := splitMessage(entity)
+	if ct := headerValue(string(h), "Content-Type"); ct != "text/plain; charset=UTF-8" {
+		t.Errorf("Invalid Content-Type, got %q", ct)
+	}
+	if string(content) != "Test" {
+		t.Errorf("Invalid decrypted content, got %q, want %q", content, "Test")
+	}
+}
+
+func TestSMIMESignAndEncrypt(t *testing.T) {
+	cert, key := newTestCertificate(t, "RSA")
+	m := NewMessage(SetSMIMESigner(cert, key), SetSMIMERecipients(cert))
+	m.SetHeader("From", "from@example.com")
+	m.SetBody("text/plain", "Test")
+	m.Attach("file.txt", SetCopyFunc(func(w io.Writer) error {
+		_, err := w.Write([]byte("Content"))
+		return err
+	}))
+
+	_, body := splitWrittenMessage(t, m)
+	entity := decryptSMIME(t, decodeBase64(t, body), cert, key.(*rsa.PrivateKey))
+
+	header, content := splitMessage(entity)
+	_, params, err := mime.ParseMediaType(headerValue(string(header), "Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, sig := splitSignedEntity(t, string(content), params["boundary"])
+	if !strings.HasPrefix(signed, "Content-Type: multipart/mixed;") {
+		t.Errorf("Invalid signed entity: %q", signed)
+	}
+	verifySMIMESignature(t, []byte(signed), sig, cert)
+}
+
+func TestSMIMEUnsupportedKey(t *testing.T) {
+	cert, _ := newTestCertificate(t, "ECDSA")
+	m := NewMessage(SetSMIMERecipients(cert))
+	m.SetBody("text/plain", "Test")
+	if _, err := m.WriteTo(new(bytes.Buffer)); err != errUnsupportedSMIMEKey {
+		t.Errorf("Invalid error, got %v, want %v", err, errUnsupportedSMIMEKey)
+	}
+}
+
+func newTestCertificate(t *testing.T, keyType string) (*x509.Certificate, crypto.Signer) {
+	var key crypto.Signer
+	var err error
+	if keyType == "RSA" {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:   serial,
+		Subject:        pkix.Name{CommonName: "from@example.com"},
+		EmailAddresses: []string{"from@example.com"},
+		NotBefore:      now().Add(-time.Hour),
+		NotAfter:       now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func splitWrittenMessage(t *testing.T, m *Message) (header, body string) {
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	h, b := splitMessage(buf.Bytes())
+	return string(h), string(b)
+}
+
+func headerValue(header, name string) string {
+	for _, f := range parseHeaderFields([]byte(header)) {
+		if strings.EqualFold(f.name, name) {
+			v := f.raw[len(f.name)+1:]
+			return strings.TrimSpace(strings.Replace(v, "\r\n", "", -1))
+		}
+	}
+	return ""
+}
+
+// splitSignedEntity returns the signed entity and the decoded signature of a
+// multipart/signed body.
+func splitSignedEntity(t *testing.T, body, boundary string) (string, []byte) {
+	parts := strings.Split(body, "\r\n--"+boundary)
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "--"+boundary+"\r\n") ||
+		!strings.HasPrefix(parts[2], "--\r\n") {
+		t.Fatalf("Invalid multipart/signed body: %q", body)
+	}
+	entity := strings.TrimPrefix(parts[0], "--"+boundary+"\r\n")
+
+	header, sig := splitMessage([]byte(parts[1]))
+	if ct := headerValue(string(header), "Content-Type"); !strings.HasPrefix(ct, "application/pkcs7-signature") {
+		t.Fatalf("Invalid signature Content-Type: %q", ct)
+	}
+	return entity, decodeBase64(t, string(sig))
+}
+
+func decodeBase64(t *testing.T, s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(strings.Replace(s, "\r\n", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+type testContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type testSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+	Certificates     []asn1.RawValue  `asn1:"implicit,tag:0"`
+	SignerInfos      []testSignerInfo `asn1:"set"`
+}
+
+type testIssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type testSignerInfo struct {
+	Version            int
+	IssuerAndSerial    testIssuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type testAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+func verifySMIMESignature(t *testing.T, entity, p7s []byte, cert *x509.Certificate) {
+	var ci testContentInfo
+	if _, err := asn1.Unmarshal(p7s, &ci); err != nil {
+		t.Fatal(err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		t.Fatalf("Invalid content type: %v", ci.ContentType)
+	}
+	var sd testSignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatal(err)
+	}
+	if len(sd.Certificates) != 1 || !bytes.Equal(sd.Certificates[0].FullBytes, cert.Raw) {
+		t.Error("Invalid certificates")
+	}
+	if len(sd.SignerInfos) != 1 {
+		t.Fatalf("Invalid number of signers: %d", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+	if si.IssuerAndSerial.Serial.Cmp(cert.SerialNumber) != 0 {
+		t.Error("Invalid serial number")
+	}
+
+	// The signature covers the signed attributes with a SET OF tag.
+	attrs := append([]byte(nil), si.SignedAttrs.FullBytes...)
+	attrs[0] = 0x31
+	var list []testAttribute
+	if _, err := asn1.UnmarshalWithParams(attrs, &list, "set"); err != nil {
+		t.Fatal(err)
+	}
+	var digest []byte
+	for _, a := range list {
+		if a.Type.Equal(oidAttributeDigest) {
+			if _, err := asn1.Unmarshal(a.Values.Bytes, &digest); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	want := sha256.Sum256(entity)
+	if !bytes.Equal(digest, want[:]) {
+		t.Error("Invalid message digest")
+	}
+
+	alg := x509.SHA256WithRSA
+	if _, ok := cert.PublicKey.(*ecdsa.PublicKey); ok {
+		alg = x509.ECDSAWithSHA256
+	}
+	if err := cert.CheckSignature(alg, attrs, si.Signature); err != nil {
+		t.Errorf("Invalid signature: %v", err)
+	}
+}
+
+type testEnvelopedData struct {
+	Version              int
+	RecipientInfos       []testRecipientInfo `asn1:"set"`
+	EncryptedContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Algorithm   struct {
+			Algorithm asn1.ObjectIdentifier
+			IV        []byte
+		}
+		EncryptedContent []byte `asn1:"tag:0"`
+	}
+}
+
+type testRecipientInfo struct {
+	Version         int
+	IssuerAndSerial testIssuerAndSerial
+	Algorithm       pkix.AlgorithmIdentifier
+	EncryptedKey    []byte
+}
+
+func decryptSMIME(t *testing.T, p7m []byte, cert *x509.Certificate, key *rsa.PrivateKey) []byte {
+	var ci testContentInfo
+	if _, err := asn1.Unmarshal(p7m, &ci); err != nil {
+		t.Fatal(err)
+	}
+	if !ci.ContentType.Equal(oidEnvelopedData) {
+		t.Fatalf("Invalid content type: %v", ci.ContentType)
+	}
+	var ed testEnvelopedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+		t.Fatal(err)
+	}
+
+	var cek []byte
+	for _, ri := range ed.RecipientInfos {
+		if ri.IssuerAndSerial.Serial.Cmp(cert.SerialNumber) != 0 {
+			continue
+		}
+		var err error
+		cek, err = rsa.DecryptPKCS1v15(rand.Reader, key, ri.EncryptedKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cek == nil {
+		t.Fatal("Recipient not found")
+	}
+
+	eci := ed.EncryptedContentInfo
+	if !eci.Algorithm.Algorithm.Equal(oidAES256CBC) {
+		t.Fatalf("Invalid content encryption algorithm: %v", eci.Algorithm.Algorithm)
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := eci.EncryptedContent
+	cipher.NewCBCDecrypter(block, eci.Algorithm.IV).CryptBlocks(content, content)
+	padding := int(content[len(content)-1])
+	return content[:len(content)-padding]
+}
@@ -1,11 +1,15 @@
 package gomail
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/smtp"
+	"net/textproto"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -23,16 +27,68 @@ type Dialer struct {
 	// Auth represents the authentication mechanism used to authenticate to the
 	// SMTP server.
 	Auth smtp.Auth
+	// TokenSource is called on each dial to get the OAuth 2.0 access token used
+	// to authenticate Username to the SMTP server. When it is set and Auth is
+	// nil, the OAUTHBEARER mechanism is used if the server supports it and the
+	// XOAUTH2 mechanism otherwise.
+	TokenSource func(ctx context.Context) (string, error)
 	// SSL defines whether an SSL connection is used. It should be false in
 	// most cases since the authentication mechanism should use the STARTTLS
 	// extension instead.
 	SSL bool
+	// StartTLSPolicy defines whether the STARTTLS extension is used when SSL
+	// is false. By default, it is OpportunisticStartTLS.
+	StartTLSPolicy StartTLSPolicy
 	// TSLConfig represents the TLS configuration used for the TLS (when the
 	// STARTTLS extension is used) or SSL connection.
 	TLSConfig *tls.Config
 	// LocalName is the hostname sent to the SMTP server with the HELO command.
 	// By default, "localhost" is sent.
 	LocalName string
+	// Timeout is the maximum amount of time to wait for the TCP connection to
+	// the SMTP server to be established. By default, it is 10 seconds.
+	Timeout time.Duration
+	// CommandTimeout is the maximum amount of time to wait for the SMTP
+	// server to reply to each command, including the initial greeting. By
+	// default, there is no timeout.
+	CommandTimeout time.Duration
+	// DataTimeout is the maximum amount of time allowed to transmit the content
+	// of an email and to receive the SMTP server's reply. By default, there is
+	// no timeout.
+	DataTimeout time.Duration
+	// SkipRejectedRecipients defines whether an email is still sent when the
+	// SMTP server rejects some of its recipients. In that case, sending only
+	// fails if all recipients are rejected. Use Deliver to know which
+	// recipients were rejected.
+	SkipRejectedRecipients bool
+}
+
+// StartTLSPolicy defines when the STARTTLS extension is used to encrypt the
+// connection to the SMTP server.
+type StartTLSPolicy int
+
+const (
+	// OpportunisticStartTLS means that STARTTLS is used only if the SMTP
+	// server supports it. Otherwise, the connection is not encrypted.
+	OpportunisticStartTLS StartTLSPolicy = iota
+	// MandatoryStartTLS means that STARTTLS must be used. Dial fails before
+	// authenticating if the SMTP server does not support it.
+	MandatoryStartTLS
+	// NoStartTLS means that STARTTLS is never used. It should only be used
+	// with local SMTP servers, e.g. for testing.
+	NoStartTLS
+)
+
+func (p StartTLSPolicy) String() string {
+	switch p {
+	case OpportunisticStartTLS:
+		return "OpportunisticStartTLS"
+	case MandatoryStartTLS:
+		return "MandatoryStartTLS"
+	case NoStartTLS:
+		return "NoStartTLS"
+	}
+	return "StartTLSPolicy(" + strconv.Itoa(int(p)) + ")"
 }
 
 // NewDialer returns a new SMTP Dialer. The given parameters are used to connect
@@ -58,60 +114,186 @@ func NewPlainDialer(host string, port int, username, password string) *Dialer {
 // Dial dials and authenticates to an SMTP server. The returned SendCloser
 // should be closed when done using it.
 func (d *Dialer) Dial() (SendCloser, error) {
-	conn, err := netDialTimeout("tcp", addr(d.Host, d.Port), 10*time.Second)
+	return d.DialContext(context.Background())
+}
+
+// DialContext dials and authenticates to an SMTP server using the provided
+// context. The context is only used while connecting: once the connection is
+// established, it has no effect on the returned SendCloser.
+//
+// The returned SendCloser also implements ContextSender so that each email can
+// be sent with its own context.
+func (d *Dialer) DialContext(ctx context.Context) (SendCloser, error) {
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	conn, err := netDialContext(ctx, "tcp", addr(d.Host, d.Port), timeout)
 	if err != nil {
+		if isTimeout(err) {
+			return nil, fmt.Errorf("gomail: connect timed out: %w", err)
+		}
 		return nil, err
 	}
 
+	// The deadlines are set on the raw connection since a TLS connection
+	// forwards them to the connection it wraps.
+	s := &smtpSender{conn: conn, d: d}
 	if d.SSL {
 		conn = tlsClient(conn, d.tlsConfig())
 	}
 
-	c, err := smtpNewClient(conn, d.Host)
-	if err != nil {
+	if err := s.do(ctx, "greeting", d.CommandTimeout, func() error {
+		var err error
+		s.smtpClient, err = smtpNewClient(conn, d.Host)
+		return err
+	}); err != nil {
+		conn.Close()
 		return nil, err
 	}
 
-	if d.LocalName != "" {
-		if err := c.Hello(d.LocalName); err != nil {
-			return nil, err
-		}
+	if err := d.handshake(ctx, s); err != nil {
+		s.smtpClient.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// defaultTimeout is the default value of Dialer.Timeout.
+const defaultTimeout = 10 * time.Second
+
+// handshake greets the SMTP server, starts TLS if possible and authenticates.
+func (d *Dialer) handshake(ctx context.Context, c *smtpSender) error {
+	localName := d.LocalName
+	if localName == "" {
+		localName = "localhost"
+	}
+	if err := c.do(ctx, "EHLO", d.CommandTimeout, func() error {
+		return c.Hello(localName)
+	}); err != nil {
+		return err
 	}
 
-	if !d.SSL {
+	if !d.SSL && d.StartTLSPolicy != NoStartTLS {
 		if ok, _ := c.Extension("STARTTLS"); ok {
-			if err := c.StartTLS(d.tlsConfig()); err != nil {
-				c.Close()
-				return nil, err
+			if err := c.do(ctx, "STARTTLS", d.CommandTimeout, func() error {
+				return c.StartTLS(d.tlsConfig())
+			}); err != nil {
+				return err
 			}
+		} else if d.StartTLSPolicy == MandatoryStartTLS {
+			return errors.New("gomail: the SMTP server does not support STARTTLS")
 		}
 	}
 
-	if d.Auth == nil && d.Username != "" {
-		if ok, auths := c.Extension("AUTH"); ok {
-			if strings.Contains(auths, "CRAM-MD5") {
-				d.Auth = smtp.CRAMMD5Auth(d.Username, d.Password)
-			} else if strings.Contains(auths, "LOGIN") &&
-				!strings.Contains(auths, "PLAIN") {
-				d.Auth = &loginAuth{
-					username: d.Username,
-					password: d.Password,
-					host:     d.Host,
+	auth, err := d.auth(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if auth != nil {
+		if err := c.do(ctx, "AUTH", d.CommandTimeout, func() error {
+			return c.Auth(auth)
+		}); err != nil {
+			if a, ok := auth.(*oauthAuth); ok {
+				if oerr := a.challengeError(); oerr != nil {
+					return fmt.Errorf("%w (%v)", err, oerr)
 				}
-			} else {
-				d.Auth = smtp.PlainAuth("", d.Username, d.Password, d.Host)
 			}
+			return err
 		}
 	}
 
+	return nil
+}
+
+// auth returns the authentication mechanism to use with the SMTP server. The
+// Dialer is not modified so that it can be used concurrently.
+func (d *Dialer) auth(ctx context.Context, c smtpClient) (smtp.Auth, error) {
 	if d.Auth != nil {
-		if err = c.Auth(d.Auth); err != nil {
-			c.Close()
-			return nil, err
+		// A SCRAM authentication keeps the state of the exchange, so each
+		// connection uses its own copy.
+		if a, ok := d.Auth.(*scramAuth); ok {
+			return a.clone(), nil
+		}
+		return d.Auth, nil
+	}
+
+	if d.TokenSource != nil {
+		ok, auths := c.Extension("AUTH")
+		if !ok {
+			return nil, nil
+		}
+		token, err := d.TokenSource(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("gomail: could not get OAuth 2.0 token: %w", err)
+		}
+		if hasMechanism(auths, "OAUTHBEARER") {
+			return OAuthBearerAuth(d.Username, token, d.Host, d.Port), nil
+		}
+		return XOAuth2Auth(d.Username, token, d.Host), nil
+	}
+
+	if d.Username == "" {
+		return nil, nil
+	}
+	ok, auths := c.Extension("AUTH")
+	if !ok {
+		return nil, nil
+	}
+
+	// The SCRAM mechanisms are preferred, the strongest first. The -PLUS
+	// variants bind the authentication to the TLS connection.
+	cs, isTLS := c.TLSConnectionState()
+	for _, mechanism := range scramMechanisms {
+		if !hasMechanism(auths, mechanism) {
+			continue
+		}
+		if !isTLS {
+			if strings.HasSuffix(mechanism, "-PLUS") {
+				continue
+			}
+			return newSCRAMAuth(mechanism, d.Username, d.Password, nil), nil
+		}
+		a := newSCRAMAuth(mechanism, d.Username, d.Password, &cs)
+		if a.plus && a.cbType == "" {
+			continue
 		}
+		return a, nil
+	}
+
+	if strings.Contains(auths, "CRAM-MD5") {
+		return smtp.CRAMMD5Auth(d.Username, d.Password), nil
+	}
+	if strings.Contains(auths, "LOGIN") && !strings.Contains(auths, "PLAIN") {
+		return &loginAuth{
+			username: d.Username,
+			password: d.Password,
+			host:     d.Host,
+		}, nil
 	}
+	return smtp.PlainAuth("", d.Username, d.Password, d.Host), nil
+}
 
-	return &smtpSender{c, d}, nil
+// scramMechanisms is the list of supported SCRAM mechanisms, from the
+// strongest to the weakest.
+var scramMechanisms = []string{
+	"SCRAM-SHA-256-PLUS",
+	"SCRAM-SHA-256",
+	"SCRAM-SHA-1-PLUS",
+	"SCRAM-SHA-1",
+}
+
+// hasMechanism returns whether the given SASL mechanism is in the list of
+// mechanisms advertised by the SMTP server.
+func hasMechanism(auths, mechanism string) bool {
+	for _, m := range strings.Fields(auths) {
+		if strings.EqualFold(m, mechanism) {
+			return true
+		}
+	}
+	return false
 }
 
 func (d *Dialer) tlsConfig() *tls.Config {
@@ -128,64 +310,421 @@ func addr(host string, port int) string {
 // DialAndSend opens a connection to the SMTP server, sends the given emails and
 // closes the connection.
 func (d *Dialer) DialAndSend(m ...*Message) error {
-	s, err := d.Dial()
+	return d.DialAndSendContext(context.Background(), m...)
+}
+
+// DialAndSendContext opens a connection to the SMTP server, sends the given
+// emails and closes the connection. If the context expires or is canceled
+// before all emails are sent, the connection is interrupted and the context's
+// error is returned.
+func (d *Dialer) DialAndSendContext(ctx context.Context, m ...*Message) error {
+	s, err := d.DialContext(ctx)
 	if err != nil {
 		return err
 	}
 	defer s.Close()
 
-	return Send(s, m...)
+	return SendContext(ctx, s, m...)
 }
 
 type smtpSender struct {
 	smtpClient
-	d *Dialer
+	conn net.Conn
+	d    *Dialer
 }
 
 func (c *smtpSender) Send(from string, to []string, msg io.WriterTo) error {
-	if err := c.Mail(from); err != nil {
-		if err == io.EOF {
-			// This is probably due to a timeout, so reconnect and try again.
-			sc, derr := c.d.Dial()
-			if derr == nil {
-				if s, ok := sc.(*smtpSender); ok {
-					*c = *s
-					return c.Send(from, to, msg)
+	return c.SendContext(context.Background(), from, to, msg)
+}
+
+func (c *smtpSender) SendContext(ctx context.Context, from string, to []string, msg io.WriterTo) error {
+	_, err := c.Deliver(ctx, from, to, msg)
+	return err
+}
+
+func (c *smtpSender) Deliver(ctx context.Context, from string, to []string, msg io.WriterTo) (*Delivery, error) {
+	var (
+		params   []string
+		t        transport
+		chunking bool
+		dsn      *Message
+	)
+	if m, ok := msg.(*Message); ok {
+		// The body type is negotiated with the SMTP server. The content it
+		// does not support is encoded when the message is written.
+		switch m.bodyType() {
+		case "BINARYMIME":
+			if c.supports("CHUNKING") && c.supports("BINARYMIME") {
+				params = append(params, "BODY=BINARYMIME")
+				chunking = true
+				break
+			}
+			fallthrough
+		case "8BITMIME":
+			if c.supports("8BITMIME") {
+				params = append(params, "BODY=8BITMIME")
+			} else {
+				t.sevenBit = true
+			}
+		}
+		// Binary content, e.g. in an attached message, can only be sent with
+		// BDAT chunking.
+		t.noBinary = !chunking
+
+		// The DSN parameters are only sent if the SMTP server supports them.
+		if m.hasDSN() && c.supports("DSN") {
+			dsn = m
+			params = append(params, m.dsnMailParams()...)
+		}
+	}
+
+	// Internationalized addresses require the SMTPUTF8 extension. Without it,
+	// only their domains can be converted to ASCII.
+	mailFrom, rcpts := from, to
+	if !isASCII(from) || !isASCII(strings.Join(to, "")) {
+		if c.supports("SMTPUTF8") {
+			t.smtputf8 = true
+			params = append(params, "SMTPUTF8")
+		} else {
+			var err error
+			if mailFrom, err = asciiAddress(from); err != nil {
+				return nil, err
+			}
+			rcpts = make([]string, len(to))
+			for i, addr := range to {
+				if rcpts[i], err = asciiAddress(addr); err != nil {
+					return nil, err
 				}
 			}
 		}
-		return err
 	}
 
-	for _, addr := range to {
-		if err := c.Rcpt(addr); err != nil {
-			return err
+	e := &envelope{
+		from:       mailFrom,
+		params:     params,
+		to:         rcpts,
+		rcptParams: make([][]string, len(to)),
+	}
+	if dsn != nil {
+		for i, addr := range to {
+			e.rcptParams[i] = dsn.dsnRcptParams(addr)
 		}
 	}
 
-	w, err := c.Data()
+	var (
+		delivery *Delivery
+		w        io.WriteCloser
+		err      error
+	)
+	if p, ok := c.smtpClient.(pipeliner); ok && c.supports("PIPELINING") {
+		delivery, w, err = c.pipelineEnvelope(ctx, p, e, to, !chunking)
+	} else {
+		delivery, err = c.sendEnvelope(ctx, e, to)
+	}
+	if err == io.EOF && delivery == nil {
+		// This is probably due to a timeout, so reconnect and try again.
+		if c.redial(ctx) == nil {
+			return c.Deliver(ctx, from, to, msg)
+		}
+	}
 	if err != nil {
+		return delivery, err
+	}
+
+	if chunking {
+		w = &bdatWriter{c: c, buf: make([]byte, 0, bdatChunkSize)}
+	} else if w == nil {
+		if err := c.do(ctx, "DATA", c.d.CommandTimeout, func() error {
+			var err error
+			w, err = c.Data()
+			return err
+		}); err != nil {
+			return delivery, err
+		}
+	}
+
+	return delivery, c.do(ctx, "message transfer", c.d.DataTimeout, func() error {
+		if err := writeMessage(w, msg, t); err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	})
+}
+
+// sendEnvelope sends the MAIL and RCPT commands of a mail transaction one at a
+// time. to holds the addresses of the recipients as given to Deliver.
+func (c *smtpSender) sendEnvelope(ctx context.Context, e *envelope, to []string) (*Delivery, error) {
+	if err := c.do(ctx, "MAIL", c.d.CommandTimeout, func() error {
+		return c.Mail(e.from, e.params...)
+	}); err != nil {
+		return nil, err
+	}
+
+	delivery := &Delivery{Accepted: make([]string, 0, len(to))}
+	for i, addr := range to {
+		err := c.do(ctx, "RCPT", c.d.CommandTimeout, func() error {
+			return c.Rcpt(e.to[i], e.rcptParams[i]...)
+		})
+		if err := c.addRecipient(delivery, addr, err); err != nil {
+			return delivery, err
+		}
+	}
+	if len(delivery.Accepted) == 0 && len(delivery.Rejected) > 0 {
+		return delivery, delivery.err()
+	}
+	return delivery, nil
+}
+
+// pipelineEnvelope sends the MAIL and RCPT commands of a mail transaction in a single
+// flight, followed by the DATA command if data is true and the email can still
+// be sent when some recipients are rejected. It returns the writer of the
+// content of the email if the DATA command was sent.
+func (c *smtpSender) pipelineEnvelope(ctx context.Context, p pipeliner, e *envelope, to []string, data bool) (*Delivery, io.WriteCloser, error) {
+	// The SMTP server accepts the DATA command as soon as one recipient is
+	// accepted, and there is no way to cancel the transaction once it did.
+	data = data && (c.d.SkipRejectedRecipients || len(to) == 1)
+
+	var r *pipelineReplies
+	if err := c.do(ctx, "MAIL", c.d.CommandTimeout, func() error {
+		var err error
+		r, err = p.Pipeline(e, data)
 		return err
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	if r.mail != nil {
+		r.abort()
+		return nil, nil, replyError("MAIL", r.mail)
+	}
+	delivery := &Delivery{Accepted: make([]string, 0, len(to))}
+	for i, addr := range to {
+		if err := c.addRecipient(delivery, addr, replyError("RCPT", r.rcpt[i])); err != nil {
+			r.abort()
+			return delivery, nil, err
+		}
+	}
+	if len(delivery.Accepted) == 0 && len(delivery.Rejected) > 0 {
+		r.abort()
+		return delivery, nil, delivery.err()
+	}
+	if r.data != nil {
+		return delivery, nil, replyError("DATA", r.data)
+	}
+	return delivery, r.w, nil
+}
+
+// addRecipient records the reply of the SMTP server to the RCPT command of
+// addr. It returns an error if the mail transaction must be aborted.
+func (c *smtpSender) addRecipient(delivery *Delivery, addr string, err error) error {
+	if err == nil {
+		delivery.Accepted = append(delivery.Accepted, addr)
+		return nil
 	}
 
-	if _, err = msg.WriteTo(w); err != nil {
-		w.Close()
+	rerr, ok := newRecipientError(addr, err)
+	if !ok {
 		return err
 	}
+	delivery.Rejected = append(delivery.Rejected, rerr)
+	if !c.d.SkipRejectedRecipients {
+		return err
+	}
+	return nil
+}
 
-	return w.Close()
+// supports returns whether the SMTP server supports the given extension.
+func (c *smtpSender) supports(ext string) bool {
+	ok, _ := c.Extension(ext)
+	return ok
+}
+
+// writeMessage writes msg to w. If msg is a Message, it is written so that it
+// can be sent with t.
+func writeMessage(w io.Writer, msg io.WriterTo, t transport) error {
+	var err error
+	if m, ok := msg.(*Message); ok {
+		_, err = m.writeTo(w, t)
+	} else {
+		_, err = msg.WriteTo(w)
+	}
+	return err
+}
+
+// bdatChunkSize is the size of the chunks sent with the BDAT command.
+const bdatChunkSize = 1 << 20
+
+// bdatWriter sends a message in chunks with the BDAT command defined in RFC
+// 3030.
+type bdatWriter struct {
+	c   smtpClient
+	buf []byte
+}
+
+func (w *bdatWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if len(w.buf) == cap(w.buf) {
+			if err := w.c.Bdat(w.buf, false); err != nil {
+				return n, err
+			}
+			w.buf = w.buf[:0]
+		}
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+// Close sends the last chunk.
+func (w *bdatWriter) Close() error {
+	return w.c.Bdat(w.buf, true)
+}
+
+// redial replaces the connection to the SMTP server, e.g. when a network error
+// left it in an unknown state.
+func (c *smtpSender) redial(ctx context.Context) error {
+	sc, err := c.d.DialContext(ctx)
+	if err != nil {
+		return err
+	}
+	c.smtpClient.Close()
+	*c = *sc.(*smtpSender)
+	return nil
+}
+
+// reset aborts the current mail transaction.
+func (c *smtpSender) reset(ctx context.Context) error {
+	return c.do(ctx, "RSET", c.d.CommandTimeout, c.Reset)
 }
 
 func (c *smtpSender) Close() error {
-	return c.Quit()
+	if err := c.do(context.Background(), "QUIT", c.d.CommandTimeout, c.Quit); err != nil {
+		c.smtpClient.Close()
+		return err
+	}
+	return nil
+}
+
+// do runs f, which executes the SMTP phase with the given name, making sure that
+// any I/O on the connection is interrupted if the phase does not complete
+// within the given timeout or as soon as ctx is done. A timeout of zero means
+// no timeout.
+//
+// If f fails because ctx is done, the context's error is returned instead of
+// the one returned by f. Error replies of the SMTP server are returned as
+// *SMTPError.
+func (c *smtpSender) do(ctx context.Context, phase string, timeout time.Duration, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	ctxDeadline := false
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+		ctxDeadline = true
+	}
+	if !deadline.IsZero() {
+		c.conn.SetDeadline(deadline)
+	}
+
+	var err error
+	if ctx.Done() == nil {
+		err = f()
+	} else {
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			select {
+			case <-ctx.Done():
+				// Unblock any pending read or write.
+				c.conn.SetDeadline(aLongTimeAgo)
+			case <-done:
+			}
+		}()
+
+		err = f()
+		close(done)
+		<-stopped
+	}
+
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if e, ok := err.(*textproto.Error); ok {
+			// The SMTP server replied so the connection can still be used.
+			if !deadline.IsZero() || ctx.Done() != nil {
+				c.conn.SetDeadline(time.Time{})
+			}
+			return newSMTPError(phase, e)
+		}
+		// Otherwise, the connection is left with a deadline: it is in an
+		// unknown state and must not be used anymore.
+		if isTimeout(err) {
+			if ctxDeadline {
+				// The deadline of the connection may expire slightly before
+				// the one of ctx.
+				return context.DeadlineExceeded
+			}
+			return fmt.Errorf("gomail: %s timed out: %w", phase, err)
+		}
+		return err
+	}
+
+	if !deadline.IsZero() || ctx.Done() != nil {
+		c.conn.SetDeadline(time.Time{})
+	}
+	return nil
+}
+
+// replyError returns err as an *SMTPError if it is an error reply of the SMTP
+// server to the command with the given name.
+func replyError(command string, err error) error {
+	if e, ok := err.(*textproto.Error); ok {
+		return newSMTPError(command, e)
+	}
+	return err
 }
 
+// isProtocolError returns whether err is an error reply of the SMTP server. In
+// that case, the connection can still be used.
+func isProtocolError(err error) bool {
+	switch err.(type) {
+	case *SMTPError, *RecipientError:
+		return true
+	}
+	return false
+}
+
+func isTimeout(err error) bool {
+	if err, ok := err.(net.Error); ok && err.Timeout() {
+		return true
+	}
+	return false
+}
+
+// aLongTimeAgo is a non-zero time, far in the past, used to immediately
+// interrupt network I/O.
+var aLongTimeAgo = time.Unix(1, 0)
+
 // Stubbed out for tests.
 var (
-	netDialTimeout = net.DialTimeout
-	tlsClient      = tls.Client
-	smtpNewClient  = func(conn net.Conn, host string) (smtpClient, error) {
-		return smtp.NewClient(conn, host)
+	netDialContext = func(ctx context.Context, network, address string, timeout time.Duration) (net.Conn, error) {
+		d := &net.Dialer{Timeout: timeout}
+		return d.DialContext(ctx, network, address)
+	}
+	tlsClient     = tls.Client
+	smtpNewClient = func(conn net.Conn, host string) (smtpClient, error) {
+		return newClient(conn, host)
 	}
 )
 
@@ -194,9 +733,49 @@ type smtpClient interface {
 	Extension(string) (bool, string)
 	StartTLS(*tls.Config) error
 	Auth(smtp.Auth) error
-	Mail(string) error
-	Rcpt(string) error
+	Mail(from string, params ...string) error
+	Rcpt(to string, params ...string) error
 	Data() (io.WriteCloser, error)
+	Bdat(chunk []byte, last bool) error
+	Noop() error
+	Reset() error
+	TLSConnectionState() (tls.ConnectionState, bool)
 	Quit() error
 	Close() error
 }
+
+// A pipeliner is an smtpClient that can send the commands of a mail
+// transaction without waiting for the replies of the SMTP server, as allowed
+// by the PIPELINING extension defined in RFC 2920.
+type pipeliner interface {
+	Pipeline(e *envelope, data bool) (*pipelineReplies, error)
+}
+
+// envelope holds the arguments of the MAIL and RCPT commands of a mail
+// transaction.
+type envelope struct {
+	from       string
+	params     []string
+	to         []string
+	rcptParams [][]string
+}
+
+// pipelineReplies holds the replies to pipelined commands. Each error is nil
+// if the command succeeded and an error reply of the SMTP server otherwise.
+type pipelineReplies struct {
+	mail error
+	rcpt []error
+	data error
+	// w writes the content of the email if the DATA command was sent and
+	// succeeded.
+	w io.WriteCloser
+}
+
+// abort ends the content of the email if the DATA command succeeded while the
+// transaction failed. The SMTP server then rejects it since it has no valid
+// recipient.
+func (r *pipelineReplies) abort() {
+	if r.w != nil {
+		r.w.Close()
+	}
+}
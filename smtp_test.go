@@ -2,11 +2,18 @@ package gomail
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"encoding/base64"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/smtp"
+	"net/textproto"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -26,6 +33,7 @@ var (
 func TestDialer(t *testing.T) {
 	d := NewDialer(testHost, testPort, "user", "pwd")
 	testSendMail(t, d, []string{
+		"Hello localhost",
 		"Extension STARTTLS",
 		"StartTLS",
 		"Extension AUTH",
@@ -44,6 +52,7 @@ func TestDialer(t *testing.T) {
 func TestDialerSSL(t *testing.T) {
 	d := NewDialer(testHost, testSSLPort, "user", "pwd")
 	testSendMail(t, d, []string{
+		"Hello localhost",
 		"Extension AUTH",
 		"Auth",
 		"Mail " + testFrom,
@@ -103,6 +112,7 @@ func TestDialerNoAuth(t *testing.T) {
 		Port: testPort,
 	}
 	testSendMail(t, d, []string{
+		"Hello localhost",
 		"Extension STARTTLS",
 		"StartTLS",
 		"Mail " + testFrom,
@@ -116,17 +126,74 @@ func TestDialerNoAuth(t *testing.T) {
 	})
 }
 
+func TestDialerMandatoryStartTLS(t *testing.T) {
+	d := NewDialer(testHost, testPort, "user", "pwd")
+	d.StartTLSPolicy = MandatoryStartTLS
+	testSendMail(t, d, []string{
+		"Hello localhost",
+		"Extension STARTTLS",
+		"StartTLS",
+		"Extension AUTH",
+		"Auth",
+		"Mail " + testFrom,
+		"Rcpt " + testTo1,
+		"Rcpt " + testTo2,
+		"Data",
+		"Write message",
+		"Close writer",
+		"Quit",
+		"Close",
+	})
+}
+
+func TestDialerMandatoryStartTLSUnsupported(t *testing.T) {
+	d := NewDialer(testHost, testPort, "user", "pwd")
+	d.StartTLSPolicy = MandatoryStartTLS
+	testClient := &mockClient{
+		t:          t,
+		want:       []string{"Hello localhost", "Extension STARTTLS", "Close"},
+		addr:       addr(d.Host, d.Port),
+		noStartTLS: true,
+	}
+	stubDial(t, testClient)
+
+	if _, err := d.Dial(); err == nil {
+		t.Error("Dial() should fail when STARTTLS is mandatory but not supported")
+	}
+}
+
+func TestDialerNoStartTLS(t *testing.T) {
+	d := NewDialer(testHost, testPort, "user", "pwd")
+	d.StartTLSPolicy = NoStartTLS
+	testSendMail(t, d, []string{
+		"Hello localhost",
+		"Extension AUTH",
+		"Auth",
+		"Mail " + testFrom,
+		"Rcpt " + testTo1,
+		"Rcpt " + testTo2,
+		"Data",
+		"Write message",
+		"Close writer",
+		"Quit",
+		"Close",
+	})
+}
+
 func TestDialerTimeout(t *testing.T) {
 	d := &Dialer{
 		Host: testHost,
 		Port: testPort,
 	}
 	testSendMailTimeout(t, d, []string{
+		"Hello localhost",
 		"Extension STARTTLS",
 		"StartTLS",
 		"Mail " + testFrom,
+		"Hello localhost",
 		"Extension STARTTLS",
 		"StartTLS",
+		"Close",
 		"Mail " + testFrom,
 		"Rcpt " + testTo1,
 		"Rcpt " + testTo2,
@@ -138,13 +205,264 @@ func TestDialerTimeout(t *testing.T) {
 	})
 }
 
+func TestDialerContextCanceled(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	netDialContext = func(ctx context.Context, network, address string, d time.Duration) (net.Conn, error) {
+		return client, nil
+	}
+	smtpNewClient = realSMTPNewClient
+
+	// The server never sends its greeting.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	d := &Dialer{Host: testHost, Port: testPort}
+	if _, err := d.DialContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("DialContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestDialerSendContextCanceled(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t:      t,
+		want:   []string{"Hello localhost", "Extension STARTTLS", "StartTLS", "Quit", "Close"},
+		addr:   addr(d.Host, d.Port),
+		config: d.TLSConfig,
+	}
+	stubDial(t, testClient)
+
+	s, err := d.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.(ContextSender).SendContext(ctx, testFrom, []string{testTo1}, getTestMessage()); err != context.Canceled {
+		t.Errorf("SendContext() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestDialerSendContextRejected(t *testing.T) {
+	server, client := net.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serveSMTP(server, []smtpStep{
+			{"EHLO localhost", "250 " + testHost},
+			{"MAIL FROM:<" + testFrom + ">", "250 OK"},
+			{"RCPT TO:<" + testTo1 + ">", "550 5.1.1 No such user"},
+			{"MAIL FROM:<" + testFrom + ">", "250 OK"},
+			{"RCPT TO:<" + testTo2 + ">", "250 OK"},
+			{"DATA", "354 Go ahead"},
+			{".", "250 OK"},
+			{"QUIT", "221 Bye"},
+		})
+	}()
+
+	netDialContext = func(ctx context.Context, network, address string, d time.Duration) (net.Conn, error) {
+		return client, nil
+	}
+	smtpNewClient = realSMTPNewClient
+
+	d := &Dialer{Host: testHost, Port: testPort, StartTLSPolicy: NoStartTLS}
+	s, err := d.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = s.(ContextSender).SendContext(ctx, testFrom, []string{testTo1}, getTestMessage())
+	if _, ok := err.(*SMTPError); !ok {
+		t.Fatalf("SendContext() = %v, want an *SMTPError", err)
+	}
+
+	// The deadline of ctx must not apply to the next email.
+	time.Sleep(100 * time.Millisecond)
+	if err := s.Send(testFrom, []string{testTo2}, getTestMessage()); err != nil {
+		t.Error(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := <-errc; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDialerCommandTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	netDialContext = func(ctx context.Context, network, address string, d time.Duration) (net.Conn, error) {
+		return client, nil
+	}
+	smtpNewClient = realSMTPNewClient
+
+	go func() {
+		// Send the greeting but never reply to EHLO.
+		io.WriteString(server, "220 "+testHost+" ESMTP\r\n")
+		io.Copy(ioutil.Discard, server)
+	}()
+
+	d := &Dialer{Host: testHost, Port: testPort, CommandTimeout: 20 * time.Millisecond}
+	_, err := d.Dial()
+	if err == nil || !strings.Contains(err.Error(), "EHLO timed out") {
+		t.Errorf("Dial() = %v, want an EHLO timeout error", err)
+	}
+}
+
+func TestDialerTokenSource(t *testing.T) {
+	tokens := 0
+	d := &Dialer{
+		Host:     testHost,
+		Port:     testPort,
+		Username: testUser,
+		TokenSource: func(ctx context.Context) (string, error) {
+			tokens++
+			return "token" + strconv.Itoa(tokens), nil
+		},
+	}
+
+	for i := 1; i <= 2; i++ {
+		testClient := &mockClient{
+			t: t,
+			want: []string{
+				"Hello localhost",
+				"Extension STARTTLS",
+				"StartTLS",
+				"Extension AUTH",
+				"Auth",
+				"Quit",
+			},
+			addr: addr(d.Host, d.Port),
+			auth: XOAuth2Auth(testUser, "token"+strconv.Itoa(i), testHost),
+		}
+		stubDial(t, testClient)
+
+		s, err := d.Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+	}
+}
+
+func TestDialerSkipRejectedRecipients(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort, SkipRejectedRecipients: true}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Mail " + testFrom,
+			"Rcpt " + testTo1,
+			"Rcpt " + testTo2,
+			"Data",
+			"Write message",
+			"Close writer",
+			"Quit",
+		},
+		addr:     addr(d.Host, d.Port),
+		rejected: map[string]bool{testTo1: true},
+	}
+	stubDial(t, testClient)
+
+	s, err := d.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	delivery, err := Deliver(context.Background(), s, getTestMessage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(delivery.Accepted, []string{testTo2}) {
+		t.Errorf("Invalid accepted recipients, got %v, want %v", delivery.Accepted, []string{testTo2})
+	}
+	if len(delivery.Rejected) != 1 || delivery.Rejected[0].Address != testTo1 || delivery.Rejected[0].Code != 550 {
+		t.Errorf("Invalid rejected recipients, got %v", delivery.Rejected)
+	}
+}
+
+func TestDialerAllRecipientsRejected(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort, SkipRejectedRecipients: true}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Mail " + testFrom,
+			"Rcpt " + testTo1,
+			"Rcpt " + testTo2,
+			"Quit",
+		},
+		addr:     addr(d.Host, d.Port),
+		rejected: map[string]bool{testTo1: true, testTo2: true},
+	}
+	stubDial(t, testClient)
+
+	s, err := d.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	delivery, err := Deliver(context.Background(), s, getTestMessage())
+	if err == nil {
+		t.Fatal("Deliver() should fail when all recipients are rejected")
+	}
+	if len(delivery.Accepted) != 0 || len(delivery.Rejected) != 2 {
+		t.Errorf("Invalid delivery, got %d accepted and %d rejected recipients, want 0 and 2",
+			len(delivery.Accepted), len(delivery.Rejected))
+	}
+}
+
+func TestDialerRejectedRecipient(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Mail " + testFrom,
+			"Rcpt " + testTo1,
+			"Quit",
+		},
+		addr:     addr(d.Host, d.Port),
+		rejected: map[string]bool{testTo1: true},
+	}
+	stubDial(t, testClient)
+
+	if err := d.DialAndSend(getTestMessage()); err == nil {
+		t.Error("DialAndSend() should fail when a recipient is rejected")
+	}
+}
+
 type mockClient struct {
-	t       *testing.T
-	i       int
-	want    []string
-	addr    string
-	config  *tls.Config
-	timeout bool
+	t        *testing.T
+	i        int
+	want     []string
+	addr     string
+	config   *tls.Config
+	timeout  bool
+	rejected map[string]bool
+	auth     smtp.Auth
+
+	noStartTLS bool
+	// unsupported are the extensions not supported, besides STARTTLS.
+	unsupported map[string]bool
+	// msg is the expected message. By default, it is testMsg.
+	msg    string
+	chunks bytes.Buffer
 }
 
 func (c *mockClient) Hello(localName string) error {
@@ -154,6 +472,9 @@ func (c *mockClient) Hello(localName string) error {
 
 func (c *mockClient) Extension(ext string) (bool, string) {
 	c.do("Extension " + ext)
+	if ext == "STARTTLS" && c.noStartTLS || c.unsupported[ext] {
+		return false, ""
+	}
 	return true, ""
 }
 
@@ -164,15 +485,19 @@ func (c *mockClient) StartTLS(config *tls.Config) error {
 }
 
 func (c *mockClient) Auth(a smtp.Auth) error {
-	if !reflect.DeepEqual(a, testAuth) {
-		c.t.Errorf("Invalid auth, got %#v, want %#v", a, testAuth)
+	want := c.auth
+	if want == nil {
+		want = testAuth
+	}
+	if !reflect.DeepEqual(a, want) {
+		c.t.Errorf("Invalid auth, got %#v, want %#v", a, want)
 	}
 	c.do("Auth")
 	return nil
 }
 
-func (c *mockClient) Mail(from string) error {
-	c.do("Mail " + from)
+func (c *mockClient) Mail(from string, params ...string) error {
+	c.do(strings.Join(append([]string{"Mail " + from}, params...), " "))
 	if c.timeout {
 		c.timeout = false
 		return io.EOF
@@ -180,14 +505,52 @@ func (c *mockClient) Mail(from string) error {
 	return nil
 }
 
-func (c *mockClient) Rcpt(to string) error {
-	c.do("Rcpt " + to)
+func (c *mockClient) Rcpt(to string, params ...string) error {
+	c.do(strings.Join(append([]string{"Rcpt " + to}, params...), " "))
+	if c.rejected[to] {
+		return &textproto.Error{Code: 550, Msg: "No such user"}
+	}
 	return nil
 }
 
 func (c *mockClient) Data() (io.WriteCloser, error) {
 	c.do("Data")
-	return &mockWriter{c: c, want: testMsg}, nil
+	want := c.msg
+	if want == "" {
+		want = testMsg
+	}
+	return &mockWriter{c: c, want: want}, nil
+}
+
+func (c *mockClient) Bdat(chunk []byte, last bool) error {
+	cmd := "Bdat " + strconv.Itoa(len(chunk))
+	if last {
+		cmd += " LAST"
+	}
+	c.do(cmd)
+	c.chunks.Write(chunk)
+	if last {
+		want := c.msg
+		if want == "" {
+			want = testMsg
+		}
+		compareBodies(c.t, c.chunks.String(), want)
+	}
+	return nil
+}
+
+func (c *mockClient) TLSConnectionState() (tls.ConnectionState, bool) {
+	return tls.ConnectionState{}, false
+}
+
+func (c *mockClient) Noop() error {
+	c.do("Noop")
+	return nil
+}
+
+func (c *mockClient) Reset() error {
+	c.do("Reset")
+	return nil
 }
 
 func (c *mockClient) Quit() error {
@@ -247,8 +610,15 @@ func doTestSendMail(t *testing.T, d *Dialer, want []string, timeout bool) {
 		config:  d.TLSConfig,
 		timeout: timeout,
 	}
+	stubDial(t, testClient)
+
+	if err := d.DialAndSend(getTestMessage()); err != nil {
+		t.Error(err)
+	}
+}
 
-	netDialTimeout = func(network, address string, d time.Duration) (net.Conn, error) {
+func stubDial(t *testing.T, testClient *mockClient) {
+	netDialContext = func(ctx context.Context, network, address string, d time.Duration) (net.Conn, error) {
 		if network != "tcp" {
 			t.Errorf("Invalid network, got %q, want tcp", network)
 		}
@@ -273,12 +643,10 @@ func doTestSendMail(t *testing.T, d *Dialer, want []string, timeout bool) {
 		}
 		return testClient, nil
 	}
-
-	if err := d.DialAndSend(getTestMessage()); err != nil {
-		t.Error(err)
-	}
 }
 
+var realSMTPNewClient = smtpNewClient
+
 func assertConfig(t *testing.T, got, want *tls.Config) {
 	if want == nil {
 		want = &tls.Config{ServerName: testHost}
@@ -290,3 +658,433 @@ func assertConfig(t *testing.T, got, want *tls.Config) {
 		t.Errorf("Invalid field InsecureSkipVerify in config, got %v, want %v", got.InsecureSkipVerify, want.InsecureSkipVerify)
 	}
 }
+
+func getBodyTypeMessage(enc Encoding) *Message {
+	m := NewMessage()
+	m.SetHeader("From", testFrom)
+	m.SetHeader("To", testTo1)
+	m.SetBody("text/plain", "¡Hola!", SetPartEncoding(enc))
+	return m
+}
+
+func bodyTypeMsg(enc, body string) string {
+	return "From: " + testFrom + "\r\n" +
+		"To: " + testTo1 + "\r\n" +
+		"Mime-Version: 1.0\r\n" +
+		"Date: Wed, 25 Jun 2014 17:46:00 +0000\r\n" +
+		"Message-ID: <1403718360.test@example.com>\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"Content-Transfer-Encoding: " + enc + "\r\n" +
+		"\r\n" +
+		body
+}
+
+func TestDialer8BITMIME(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Extension 8BITMIME",
+			"Mail " + testFrom + " BODY=8BITMIME",
+			"Rcpt " + testTo1,
+			"Data",
+			"Write message",
+			"Close writer",
+			"Quit",
+			"Close",
+		},
+		addr: addr(d.Host, d.Port),
+		msg:  bodyTypeMsg("8bit", "¡Hola!"),
+	}
+	stubDial(t, testClient)
+
+	if err := d.DialAndSend(getBodyTypeMessage(Unencoded)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDialer8BITMIMEUnsupported(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Extension 8BITMIME",
+			"Mail " + testFrom,
+			"Rcpt " + testTo1,
+			"Data",
+			"Write message",
+			"Close writer",
+			"Quit",
+			"Close",
+		},
+		addr:        addr(d.Host, d.Port),
+		unsupported: map[string]bool{"8BITMIME": true},
+		msg:         bodyTypeMsg("quoted-printable", "=C2=A1Hola!"),
+	}
+	stubDial(t, testClient)
+
+	if err := d.DialAndSend(getBodyTypeMessage(Unencoded)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDialer8BITMIMEAttachedBinary(t *testing.T) {
+	attached := NewMessage()
+	attached.SetHeader("From", testFrom)
+	attached.SetBody("text/plain", "¡Hola!", SetPartEncoding(Binary))
+	m := NewMessage(SetBoundaryFunc(func() string { return "_BOUNDARY_" }))
+	m.SetHeader("From", testFrom)
+	m.SetHeader("To", testTo1)
+	m.SetBody("text/plain", "Test")
+	m.AttachMessage(attached)
+
+	// The binary part of the attached message must be encoded.
+	buf := new(bytes.Buffer)
+	if _, err := m.writeTo(buf, transport{noBinary: true}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "binary") {
+		t.Fatalf("Message has binary content:\n%s", buf)
+	}
+
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Extension 8BITMIME",
+			"Mail " + testFrom + " BODY=8BITMIME",
+			"Rcpt " + testTo1,
+			"Data",
+			"Write message",
+			"Close writer",
+			"Quit",
+			"Close",
+		},
+		addr:        addr(d.Host, d.Port),
+		unsupported: map[string]bool{"BINARYMIME": true},
+		msg:         buf.String(),
+	}
+	stubDial(t, testClient)
+
+	if err := d.DialAndSend(m); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDialerBINARYMIME(t *testing.T) {
+	m := getBodyTypeMessage(Binary)
+	msg := bodyTypeMsg("binary", "¡Hola!")
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Extension CHUNKING",
+			"Extension BINARYMIME",
+			"Mail " + testFrom + " BODY=BINARYMIME",
+			"Rcpt " + testTo1,
+			"Bdat " + strconv.Itoa(len(msg)) + " LAST",
+			"Quit",
+			"Close",
+		},
+		addr: addr(d.Host, d.Port),
+		msg:  msg,
+	}
+	stubDial(t, testClient)
+
+	if err := d.DialAndSend(m); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDialerBINARYMIMEUnsupported(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Extension CHUNKING",
+			"Extension 8BITMIME",
+			"Mail " + testFrom + " BODY=8BITMIME",
+			"Rcpt " + testTo1,
+			"Data",
+			"Write message",
+			"Close writer",
+			"Quit",
+			"Close",
+		},
+		addr:        addr(d.Host, d.Port),
+		unsupported: map[string]bool{"CHUNKING": true},
+		msg:         bodyTypeMsg("quoted-printable", "=C2=A1Hola!"),
+	}
+	stubDial(t, testClient)
+
+	if err := d.DialAndSend(getBodyTypeMessage(Binary)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBDATWriter(t *testing.T) {
+	c := &mockClient{
+		t:    t,
+		want: []string{"Bdat 4", "Bdat 4", "Bdat 2 LAST"},
+		msg:  "0123456789",
+	}
+	w := &bdatWriter{c: c, buf: make([]byte, 0, 4)}
+	for _, s := range []string{"012", "3456", "789"} {
+		if _, err := io.WriteString(w, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c.i != len(c.want) {
+		t.Errorf("Missing commands: %q", c.want[c.i:])
+	}
+}
+
+func TestClientBdat(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn := textproto.NewConn(server)
+		conn.PrintfLine("220 %s ESMTP", testHost)
+		line, err := conn.ReadLine()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		chunk := make([]byte, 7)
+		if _, err := io.ReadFull(conn.R, chunk); err != nil {
+			received <- err.Error()
+			return
+		}
+		conn.PrintfLine("250 OK")
+		received <- line + "|" + string(chunk)
+	}()
+
+	c, err := realSMTPNewClient(client, testHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Bdat([]byte("a\nb\r\n.\r"), true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-received, "BDAT 7 LAST|a\nb\r\n.\r"; got != want {
+		t.Errorf("Invalid BDAT command, got %q, want %q", got, want)
+	}
+}
+
+func TestDialerPipelining(t *testing.T) {
+	tests := []struct {
+		skip     bool
+		flights  [][]string
+		replies  [][]string
+		accepted []string
+	}{
+		{
+			skip: true,
+			flights: [][]string{{
+				"MAIL FROM:<" + testFrom + ">",
+				"RCPT TO:<" + testTo1 + ">",
+				"RCPT TO:<" + testTo2 + ">",
+				"DATA",
+			}},
+			replies:  [][]string{{"250 OK", "550 5.1.1 Unknown user", "250 OK", "354 Go ahead"}},
+			accepted: []string{testTo2},
+		},
+		{
+			// The DATA command is not pipelined since the email must not be
+			// sent if a recipient is rejected.
+			flights: [][]string{{
+				"MAIL FROM:<" + testFrom + ">",
+				"RCPT TO:<" + testTo1 + ">",
+				"RCPT TO:<" + testTo2 + ">",
+			}, {
+				"DATA",
+			}},
+			replies:  [][]string{{"250 OK", "250 OK", "250 OK"}, {"354 Go ahead"}},
+			accepted: []string{testTo1, testTo2},
+		},
+	}
+
+	for _, test := range tests {
+		server, client := net.Pipe()
+		netDialContext = func(ctx context.Context, network, address string, d time.Duration) (net.Conn, error) {
+			return client, nil
+		}
+		smtpNewClient = realSMTPNewClient
+
+		done := make(chan error, 1)
+		go func() {
+			done <- servePipelining(server, test.flights, test.replies)
+		}()
+
+		d := &Dialer{
+			Host:                   testHost,
+			Port:                   testPort,
+			StartTLSPolicy:         NoStartTLS,
+			SkipRejectedRecipients: test.skip,
+			CommandTimeout:         time.Second,
+		}
+		s, err := d.Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		delivery, err := Deliver(context.Background(), s, getTestMessage())
+		if err != nil {
+			t.Errorf("Deliver() with SkipRejectedRecipients %v: %v", test.skip, err)
+		} else if !reflect.DeepEqual(delivery.Accepted, test.accepted) {
+			t.Errorf("Invalid accepted recipients, got %q, want %q", delivery.Accepted, test.accepted)
+		}
+		s.Close()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		server.Close()
+	}
+}
+
+// servePipelining reads each flight of commands before sending their replies,
+// so that a client waiting for a reply between two commands of the same flight
+// times out.
+func servePipelining(server net.Conn, flights, replies [][]string) error {
+	conn := textproto.NewConn(server)
+	conn.PrintfLine("220 %s ESMTP", testHost)
+	if _, err := conn.ReadLine(); err != nil {
+		return err
+	}
+	conn.PrintfLine("250-%s\r\n250 PIPELINING", testHost)
+
+	for i, flight := range flights {
+		for _, want := range flight {
+			line, err := conn.ReadLine()
+			if err != nil {
+				return err
+			}
+			if line != want {
+				return fmt.Errorf("Invalid command, got %q, want %q", line, want)
+			}
+		}
+		for _, reply := range replies[i] {
+			conn.PrintfLine("%s", reply)
+		}
+	}
+
+	body, err := conn.ReadDotBytes()
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(body), testBody) {
+		return fmt.Errorf("Invalid message:\n%s", body)
+	}
+	conn.PrintfLine("250 OK")
+	if line, err := conn.ReadLine(); err != nil || line != "QUIT" {
+		return fmt.Errorf("Invalid command, got %q (%v), want QUIT", line, err)
+	}
+	conn.PrintfLine("221 Bye")
+	return nil
+}
+
+func TestClientAuth(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	lines := make(chan []string, 1)
+	go func() {
+		conn := textproto.NewConn(server)
+		conn.PrintfLine("220 %s ESMTP", testHost)
+		var got []string
+		for _, reply := range []string{
+			"250-" + testHost + "\r\n250 AUTH LOGIN",
+			"334 VXNlcm5hbWU6",
+			"334 UGFzc3dvcmQ6",
+			"235 2.7.0 Accepted",
+		} {
+			line, err := conn.ReadLine()
+			if err != nil {
+				break
+			}
+			got = append(got, line)
+			conn.PrintfLine("%s", reply)
+		}
+		lines <- got
+	}()
+
+	c, err := realSMTPNewClient(client, testHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Hello("localhost"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, auths := c.Extension("auth"); !ok || auths != "LOGIN" {
+		t.Errorf("Extension(auth) = %v, %q, want true, %q", ok, auths, "LOGIN")
+	}
+	a := &loginAuth{username: testUser, password: testPwd, host: testHost}
+	if err := c.Auth(a); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"EHLO localhost",
+		"AUTH LOGIN",
+		base64.StdEncoding.EncodeToString([]byte(testUser)),
+		base64.StdEncoding.EncodeToString([]byte(testPwd)),
+	}
+	if got := <-lines; !reflect.DeepEqual(got, want) {
+		t.Errorf("Invalid commands, got %q, want %q", got, want)
+	}
+}
+
+// An smtpStep is a command expected by serveSMTP and its reply. A command "."
+// means that the content of an email is read and an empty reply that none is
+// sent.
+type smtpStep struct {
+	cmd, reply string
+}
+
+// serveSMTP sends the greeting, runs the given steps on server and then closes
+// it.
+func serveSMTP(server net.Conn, steps []smtpStep) error {
+	defer server.Close()
+	conn := textproto.NewConn(server)
+	conn.PrintfLine("220 %s ESMTP", testHost)
+	for _, step := range steps {
+		if step.cmd == "." {
+			if _, err := conn.ReadDotBytes(); err != nil {
+				return err
+			}
+		} else {
+			line, err := conn.ReadLine()
+			if err != nil {
+				return err
+			}
+			if line != step.cmd {
+				return fmt.Errorf("Invalid command, got %q, want %q", line, step.cmd)
+			}
+		}
+		if step.reply != "" {
+			conn.PrintfLine("%s", step.reply)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package gomail
+
+import (
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// exportHeader returns the header of the message as it must be written.
+//
+// If smtputf8 is true, the SMTP server supports the SMTPUTF8 extension so the
+// encoded words are decoded and the header is written in UTF-8 as defined in
+// RFC 6532. Otherwise, the internationalized domains of the addresses are
+// converted to ASCII.
+func (m *Message) exportHeader(smtputf8 bool) header {
+	h := m.header
+	copied := false
+	for field, values := range m.header {
+		var converted []string
+		if addressHeaders[field] {
+			converted = m.exportAddresses(values, smtputf8)
+		} else if smtputf8 {
+			converted = decodeWords(values)
+		}
+		if converted == nil {
+			continue
+		}
+
+		if !copied {
+			h = make(header, len(m.header))
+			for k, v := range m.header {
+				h[k] = v
+			}
+			copied = true
+		}
+		h[field] = converted
+	}
+	return h
+}
+
+// exportAddresses returns the values of an address field as they must be
+// written, or nil if they can be written as is.
+func (m *Message) exportAddresses(values []string, smtputf8 bool) []string {
+	if !smtputf8 && isASCII(strings.Join(values, "")) {
+		return nil
+	}
+
+	converted := make([]string, len(values))
+	for i, v := range values {
+		list, err := mail.ParseAddressList(v)
+		if err != nil {
+			converted[i] = v
+			continue
+		}
+		addrs := make([]string, len(list))
+		for j, a := range list {
+			if smtputf8 {
+				addrs[j] = formatUTF8Address(a.Address, a.Name)
+			} else if addr, ok := toASCIIAddress(a.Address); ok {
+				addrs[j] = m.FormatAddress(addr, a.Name)
+			} else {
+				addrs[j] = m.FormatAddress(a.Address, a.Name)
+			}
+		}
+		converted[i] = strings.Join(addrs, ", ")
+	}
+	return converted
+}
+
+// formatUTF8Address formats an address and a name without encoding the name.
+func formatUTF8Address(address, name string) string {
+	if name == "" {
+		return address
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `" <` + address + ">"
+}
+
+// decodeWords returns the values with their encoded words decoded, or nil if
+// they have none.
+func decodeWords(values []string) []string {
+	var decoded []string
+	dec := new(mime.WordDecoder)
+	for i, v := range values {
+		if !strings.Contains(v, "=?") {
+			continue
+		}
+		d, err := dec.DecodeHeader(v)
+		if err != nil || d == v {
+			continue
+		}
+		if decoded == nil {
+			decoded = append([]string(nil), values...)
+		}
+		decoded[i] = d
+	}
+	return decoded
+}
+
+// asciiAddress converts the domain of an internationalized address to ASCII.
+// It fails if the local part is not in ASCII since the address can only be
+// used with the SMTPUTF8 extension.
+func asciiAddress(addr string) (string, error) {
+	if isASCII(addr) {
+		return addr, nil
+	}
+	a, ok := toASCIIAddress(addr)
+	if !ok {
+		return "", fmt.Errorf("gomail: the SMTP server does not support SMTPUTF8, required by the address %q", addr)
+	}
+	return a, nil
+}
+
+// toASCIIAddress converts the domain of addr to ASCII. It returns false if the
+// local part is not in ASCII.
+func toASCIIAddress(addr string) (string, bool) {
+	i := strings.LastIndexByte(addr, '@')
+	if i == -1 || !isASCII(addr[:i]) {
+		return "", false
+	}
+	return addr[:i+1] + toASCIIDomain(addr[i+1:]), true
+}
+
+// toASCIIDomain converts the labels of an internationalized domain name to
+// their punycode form as defined in RFC 5891.
+func toASCIIDomain(domain string) string {
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		if !isASCII(label) {
+			labels[i] = "xn--" + punycode(strings.ToLower(label))
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Punycode parameters defined in RFC 3492, section 5.
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// punycode encodes s as defined in RFC 3492.
+func punycode(s string) string {
+	runes := []rune(s)
+	var out []byte
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for h := basic; h < len(runes); {
+		next := rune(utf8.MaxRune)
+		for _, r := range runes {
+			if r >= n && r < next {
+				next = r
+			}
+		}
+		delta += int(next-n) * (h + 1)
+		n = next
+
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := k - bias
+				if t < punyTMin {
+					t = punyTMin
+				} else if t > punyTMax {
+					t = punyTMax
+				}
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, h+1, h == basic)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+	return string(out)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > (punyBase-punyTMin)*punyTMax/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
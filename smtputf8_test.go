@@ -0,0 +1,140 @@
+package gomail
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testUTF8Body = "Mime-Version: 1.0\r\n" +
+	"Date: Wed, 25 Jun 2014 17:46:00 +0000\r\n" +
+	"Content-Type: text/plain; charset=UTF-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	testBody
+
+func getUTF8Message(from string) *Message {
+	m := NewMessage()
+	m.SetHeader("From", from)
+	m.SetHeader("To", testTo1)
+	m.SetHeader("Subject", "¡Hola!")
+	m.SetBody("text/plain", testBody)
+	return m
+}
+
+func TestDialerSMTPUTF8(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Extension SMTPUTF8",
+			"Mail 用户@例子.测试 SMTPUTF8",
+			"Rcpt " + testTo1,
+			"Data",
+			"Write message",
+			"Close writer",
+			"Quit",
+			"Close",
+		},
+		addr: addr(d.Host, d.Port),
+		msg: "From: \"Señor\" <用户@例子.测试>\r\n" +
+			"To: " + testTo1 + "\r\n" +
+			"Subject: ¡Hola!\r\n" +
+			"Message-ID: <1403718360.test@xn--fsqu00a.xn--0zwm56d>\r\n" +
+			testUTF8Body,
+	}
+	stubDial(t, testClient)
+
+	if err := d.DialAndSend(getUTF8Message("Señor <用户@例子.测试>")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDialerSMTPUTF8Unsupported(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Extension SMTPUTF8",
+			"Mail from@xn--fsqu00a.xn--0zwm56d",
+			"Rcpt " + testTo1,
+			"Data",
+			"Write message",
+			"Close writer",
+			"Quit",
+			"Close",
+		},
+		addr:        addr(d.Host, d.Port),
+		unsupported: map[string]bool{"SMTPUTF8": true},
+		msg: "From: from@xn--fsqu00a.xn--0zwm56d\r\n" +
+			"To: " + testTo1 + "\r\n" +
+			"Subject: =?UTF-8?q?=C2=A1Hola!?=\r\n" +
+			"Message-ID: <1403718360.test@xn--fsqu00a.xn--0zwm56d>\r\n" +
+			testUTF8Body,
+	}
+	stubDial(t, testClient)
+
+	if err := d.DialAndSend(getUTF8Message("from@例子.测试")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDialerSMTPUTF8Required(t *testing.T) {
+	d := &Dialer{Host: testHost, Port: testPort}
+	testClient := &mockClient{
+		t: t,
+		want: []string{
+			"Hello localhost",
+			"Extension STARTTLS",
+			"StartTLS",
+			"Extension SMTPUTF8",
+			"Quit",
+		},
+		addr:        addr(d.Host, d.Port),
+		unsupported: map[string]bool{"SMTPUTF8": true},
+	}
+	stubDial(t, testClient)
+
+	if err := d.DialAndSend(getUTF8Message("用户@例子.测试")); err == nil {
+		t.Error("DialAndSend() should fail when SMTPUTF8 is required but not supported")
+	}
+}
+
+func TestSetHeaderUTF8Address(t *testing.T) {
+	m := NewMessage()
+	m.SetHeader("To", "Señor <用户@例子.测试>", "bob@example.com")
+	want := []string{"=?UTF-8?q?Se=C3=B1or?= <用户@例子.测试>", "bob@example.com"}
+	if got := m.GetHeader("To"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Invalid To field, got %q, want %q", got, want)
+	}
+
+	to, err := m.getRecipients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"用户@例子.测试", "bob@example.com"}; !reflect.DeepEqual(to, want) {
+		t.Errorf("Invalid recipients, got %q, want %q", to, want)
+	}
+}
+
+func TestPunycode(t *testing.T) {
+	tests := []struct {
+		domain, ascii string
+	}{
+		{"example.com", "example.com"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"MÜNCHEN.de", "xn--mnchen-3ya.de"},
+		{"例子.测试", "xn--fsqu00a.xn--0zwm56d"},
+	}
+
+	for _, test := range tests {
+		if got := toASCIIDomain(test.domain); got != test.ascii {
+			t.Errorf("toASCIIDomain(%q) = %q, want %q", test.domain, got, test.ascii)
+		}
+	}
+}
@@ -1,23 +1,67 @@
 package gomail
 
 import (
+	"bytes"
 	"encoding/base64"
 	"errors"
 	"io"
 	"mime"
 	"mime/multipart"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
 
 // WriteTo implements io.WriterTo. It dumps the whole message into w.
 func (m *Message) WriteTo(w io.Writer) (int64, error) {
-	mw := &messageWriter{w: w}
+	return m.writeTo(w, transport{})
+}
+
+// A transport describes what the SMTP server accepts. The zero value writes the
+// message as is.
+type transport struct {
+	// smtputf8 is true if the header can be written in UTF-8 as allowed by the
+	// SMTPUTF8 extension.
+	smtputf8 bool
+	// sevenBit is true if 8-bit content must be encoded because the 8BITMIME
+	// extension is not supported.
+	sevenBit bool
+	// noBinary is true if binary content must be encoded because the
+	// BINARYMIME extension is not supported.
+	noBinary bool
+}
+
+// partEncoding returns the encoding of a part that can be sent with t.
+func (t transport) partEncoding(enc Encoding) Encoding {
+	if enc == Binary && t.noBinary || enc == Unencoded && t.sevenBit {
+		return QuotedPrintable
+	}
+	return enc
+}
+
+// writeTo dumps the whole message into w so that it can be sent with t.
+func (m *Message) writeTo(w io.Writer, t transport) (int64, error) {
+	if m.dkim != nil {
+		return m.writeSigned(w, t)
+	}
+
+	mw := &messageWriter{w: w, headerOrder: m.headerOrder, t: t}
 	mw.writeMessage(m)
 	return mw.n, mw.err
 }
 
+// writeSigned dumps the message into w, preceded by its DKIM signature.
+func (m *Message) writeSigned(w io.Writer, t transport) (int64, error) {
+	buf := new(bytes.Buffer)
+	mw := &messageWriter{w: buf, headerOrder: m.headerOrder, t: t}
+	mw.writeMessage(m)
+	if mw.err != nil {
+		return 0, mw.err
+	}
+	return m.dkim.Sign(w, buf.Bytes())
+}
+
 func (w *messageWriter) writeMessage(m *Message) {
 	if _, ok := m.header["Mime-Version"]; !ok {
 		w.writeString("Mime-Version: 1.0\r\n")
@@ -25,20 +69,63 @@ func (w *messageWriter) writeMessage(m *Message) {
 	if _, ok := m.header["Date"]; !ok {
 		w.writeHeader("Date", m.FormatDate(now()))
 	}
-	w.writeHeaders(m.header)
+	h := m.exportHeader(w.t.smtputf8)
+	if _, ok := m.headerMessageID(); !ok {
+		// The generated Message-ID is added to a copy of the header so that
+		// writing the message does not modify it.
+		h = h.with("Message-ID", m.MessageID())
+	}
+	w.repeatedFields = m.repeatedFields
+	w.writeHeaders(h)
 
+	if len(m.wrappers) > 0 {
+		w.writeWrappedContent(m)
+		return
+	}
+	w.writeContent(m)
+}
+
+// writeWrappedContent writes the MIME entity holding the content of the
+// message after it has been transformed by the wrappers of the message.
+func (w *messageWriter) writeWrappedContent(m *Message) {
+	buf := new(bytes.Buffer)
+	cw := &messageWriter{w: buf, headerOrder: w.headerOrder, t: w.t}
+	cw.writeContent(m)
+	if cw.err != nil {
+		w.err = cw.err
+		return
+	}
+
+	entity := buf.Bytes()
+	for _, wrap := range m.wrappers {
+		buf = new(bytes.Buffer)
+		if err := wrap(m, buf, entity); err != nil {
+			w.err = err
+			return
+		}
+		entity = buf.Bytes()
+	}
+	w.Write(entity)
+}
+
+// writeContent writes the MIME entity holding the content of the message: its
+// parts, embedded files and attachments.
+func (w *messageWriter) writeContent(m *Message) {
 	if m.hasMixedPart() {
-		w.openMultipart("mixed")
+		w.openMultipart("mixed", m.newBoundary())
 	}
 
 	if m.hasRelatedPart() {
-		w.openMultipart("related")
+		w.openMultipart("related", m.newBoundary())
 	}
 
 	if m.hasAlternativePart() {
-		w.openMultipart("alternative")
+		w.openMultipart("alternative", m.newBoundary())
+	}
+	if w.err != nil {
+		return
 	}
-	for _, part := range m.parts {
+	for _, part := range m.bodyParts() {
 		w.writePart(part, m.charset)
 	}
 	if m.hasAlternativePart() {
@@ -56,6 +143,14 @@ func (w *messageWriter) writeMessage(m *Message) {
 	}
 }
 
+// newBoundary returns a new multipart boundary.
+func (m *Message) newBoundary() string {
+	if m.boundary != nil {
+		return m.boundary()
+	}
+	return multipart.NewWriter(nil).Boundary()
+}
+
 func (m *Message) hasMixedPart() bool {
 	return (len(m.parts) > 0 && len(m.attachments) > 0) || len(m.attachments) > 1
 }
@@ -65,20 +160,29 @@ func (m *Message) hasRelatedPart() bool {
 }
 
 func (m *Message) hasAlternativePart() bool {
-	return len(m.parts) > 1
+	return len(m.bodyParts()) > 1
 }
 
 type messageWriter struct {
-	w          io.Writer
-	n          int64
-	writers    [3]*multipart.Writer
-	partWriter io.Writer
-	depth      uint8
-	err        error
+	w           io.Writer
+	n           int64
+	writers     [3]*multipart.Writer
+	partWriter  io.Writer
+	depth       uint8
+	err         error
+	headerOrder []string
+	t           transport
+	// repeatedFields holds the header fields whose values are written as
+	// distinct fields.
+	repeatedFields map[string]bool
 }
 
-func (w *messageWriter) openMultipart(mimeType string) {
+func (w *messageWriter) openMultipart(mimeType, boundary string) {
 	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		w.err = err
+		return
+	}
 	contentType := "multipart/" + mimeType + ";\r\n boundary=" + mw.Boundary()
 	w.writers[w.depth] = mw
 
@@ -105,11 +209,15 @@ func (w *messageWriter) closeMultipart() {
 }
 
 func (w *messageWriter) writePart(p *part, charset string) {
+	if p.charset != "" {
+		charset = p.charset
+	}
+	enc := w.t.partEncoding(p.encoding)
 	w.writeHeaders(map[string][]string{
 		"Content-Type":              {p.contentType + "; charset=" + charset},
-		"Content-Transfer-Encoding": {string(p.encoding)},
+		"Content-Transfer-Encoding": {string(enc)},
 	})
-	w.writeBody(p.copier, p.encoding)
+	w.writeBody(p.copier, enc)
 }
 
 func (w *messageWriter) addFiles(files []*file, isAttachment bool) {
@@ -122,8 +230,48 @@ func (w *messageWriter) addFiles(files []*file, isAttachment bool) {
 			f.setHeader("Content-Type", mediaType+`; name="`+f.Name+`"`)
 		}
 
-		if _, ok := f.Header["Content-Transfer-Encoding"]; !ok {
-			f.setHeader("Content-Transfer-Encoding", string(Base64))
+		copyFunc, enc := f.CopyFunc, f.encoding
+		switch enc {
+		case Unencoded:
+			// The content is written as is, so its encoding must be known
+			// before writing the header.
+			buf := new(bytes.Buffer)
+			var err error
+			if f.writeTo != nil {
+				err = f.writeTo(buf, w.t)
+			} else {
+				err = f.CopyFunc(buf)
+			}
+			if err != nil {
+				w.err = err
+				return
+			}
+			copyFunc = newCopier(buf.String())
+			switch {
+			case !has8bit(buf.Bytes()):
+				f.setHeader("Content-Transfer-Encoding", "7bit")
+			case w.t.sevenBit:
+				// RFC 2046 only allows the 7bit, 8bit and binary encodings
+				// for message and multipart parts.
+				if isCompositeType(f.Header["Content-Type"]) {
+					w.err = errors.New("gomail: " + f.Name + " has 8-bit content but the SMTP server does not support 8BITMIME")
+					return
+				}
+				enc = Base64
+				f.setHeader("Content-Transfer-Encoding", string(Base64))
+			default:
+				f.setHeader("Content-Transfer-Encoding", "8bit")
+			}
+		case "":
+			enc = Base64
+			if _, ok := f.Header["Content-Transfer-Encoding"]; !ok {
+				f.setHeader("Content-Transfer-Encoding", string(Base64))
+			}
+		default:
+			if enc == Binary && w.t.noBinary {
+				enc = Base64
+			}
+			f.setHeader("Content-Transfer-Encoding", string(enc))
 		}
 
 		if _, ok := f.Header["Content-Disposition"]; !ok {
@@ -133,19 +281,68 @@ func (w *messageWriter) addFiles(files []*file, isAttachment bool) {
 			} else {
 				disp = "inline"
 			}
-			f.setHeader("Content-Disposition", disp+`; filename="`+f.Name+`"`)
+			// A file read by ReadMessage may have no name.
+			if f.Name != "" {
+				disp += `; filename="` + f.Name + `"`
+			}
+			f.setHeader("Content-Disposition", disp)
 		}
 
-		if !isAttachment {
+		if !isAttachment && f.Name != "" {
 			if _, ok := f.Header["Content-ID"]; !ok {
 				f.setHeader("Content-ID", "<"+f.Name+">")
 			}
 		}
 		w.writeHeaders(f.Header)
-		w.writeBody(f.CopyFunc, Base64)
+		w.writeBody(copyFunc, enc)
 	}
 }
 
+// bodyType returns the BODY parameter required to send the message: BINARYMIME
+// if it has binary content, 8BITMIME if it may have 8-bit content, or an empty
+// string.
+func (m *Message) bodyType() string {
+	body := ""
+	for _, p := range m.parts {
+		switch p.encoding {
+		case Binary:
+			return "BINARYMIME"
+		case Unencoded:
+			body = "8BITMIME"
+		}
+	}
+	for _, files := range [][]*file{m.embedded, m.attachments} {
+		for _, f := range files {
+			switch f.encoding {
+			case Binary:
+				return "BINARYMIME"
+			case Unencoded:
+				body = "8BITMIME"
+			}
+		}
+	}
+	return body
+}
+
+// isCompositeType reports whether the Content-Type field of a part is a message
+// or multipart media type.
+func isCompositeType(contentType []string) bool {
+	if len(contentType) == 0 {
+		return false
+	}
+	t := strings.ToLower(strings.TrimSpace(contentType[0]))
+	return strings.HasPrefix(t, "message/") || strings.HasPrefix(t, "multipart/")
+}
+
+func has8bit(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
 func (w *messageWriter) Write(p []byte) (int, error) {
 	if w.err != nil {
 		return 0, errors.New("gomail: cannot write as writer is in error")
@@ -240,9 +437,15 @@ func (w *messageWriter) writeLine(s string, charsLeft int) string {
 
 func (w *messageWriter) writeHeaders(h map[string][]string) {
 	if w.depth == 0 {
-		for k, v := range h {
-			if k != "Bcc" {
-				w.writeHeader(k, v...)
+		for _, k := range sortFields(h, w.headerOrder) {
+			switch {
+			case k == "Bcc":
+			case w.repeatedFields[k]:
+				for _, v := range h[k] {
+					w.writeHeader(k, v)
+				}
+			default:
+				w.writeHeader(k, h[k]...)
 			}
 		}
 	} else {
@@ -250,6 +453,29 @@ func (w *messageWriter) writeHeaders(h map[string][]string) {
 	}
 }
 
+// sortFields returns the header fields of h so that they are always written in
+// the same order: the fields of order come first and the others are sorted
+// alphabetically.
+func sortFields(h map[string][]string, order []string) []string {
+	rank := make(map[string]int, len(order))
+	for i, f := range order {
+		rank[strings.ToLower(f)] = len(order) - i
+	}
+
+	fields := make([]string, 0, len(h))
+	for k := range h {
+		fields = append(fields, k)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		ri, rj := rank[strings.ToLower(fields[i])], rank[strings.ToLower(fields[j])]
+		if ri != rj {
+			return ri > rj
+		}
+		return fields[i] < fields[j]
+	})
+	return fields
+}
+
 func (w *messageWriter) writeBody(f func(io.Writer) error, enc Encoding) {
 	var subWriter io.Writer
 	if w.depth == 0 {
@@ -263,7 +489,7 @@ func (w *messageWriter) writeBody(f func(io.Writer) error, enc Encoding) {
 		wc := base64.NewEncoder(base64.StdEncoding, newBase64LineWriter(subWriter))
 		w.err = f(wc)
 		wc.Close()
-	} else if enc == Unencoded {
+	} else if enc == Unencoded || enc == Binary {
 		w.err = f(subWriter)
 	} else {
 		wc := newQPWriter(subWriter)